@@ -10,6 +10,15 @@ import (
 const batchFlag = '@'
 const batchSplit = ';'
 
+// aggregatorKey identifies the transactions or events aggregated together.
+type aggregatorKey struct {
+	mtype, name string
+}
+
+func (k aggregatorKey) hash() uint32 {
+	return hasher(k.mtype)*31 + hasher(k.name)
+}
+
 type catLocalAggregator struct {
 	event       *eventAggregator
 	transaction *transactionAggregator
@@ -31,6 +40,51 @@ func (p *catLocalAggregator) Background() {
 	go background(p.metric)
 }
 
+// collectAndSend sends the windows being aggregated at once, rather than at their next tick.
+func (p *catLocalAggregator) collectAndSend() {
+	p.transaction.collectAndSend()
+	p.event.collectAndSend()
+	p.metric.collectAndSend()
+}
+
+// aggregatorTree sends the children of an aggregator in as many trees as needed for none of them
+// to be truncated by the tree limits.
+type aggregatorTree struct {
+	name  string
+	flush message.Flush
+
+	t     *message.Transaction
+	count int
+}
+
+func newAggregatorTree(name string, flush message.Flush) *aggregatorTree {
+	return &aggregatorTree{
+		name:  name,
+		flush: flush,
+	}
+}
+
+func (p *aggregatorTree) add(m message.Messager) {
+	children, size := message.TreeLimits()
+	if p.t != nil && (children > 0 && p.count >= children || size > 0 && p.count >= size) {
+		p.complete()
+	}
+	if p.t == nil {
+		p.t = message.NewTransaction(typeSystem, p.name, p.flush)
+	}
+	p.t.AddChild(m)
+	p.count++
+}
+
+// complete sends the last tree, if any.
+func (p *aggregatorTree) complete() {
+	if p.t != nil {
+		p.t.Complete()
+		p.t = nil
+		p.count = 0
+	}
+}
+
 type Buf struct {
 	bytes.Buffer
 }
@@ -55,34 +109,51 @@ func (b *Buf) WriteUInt64(i uint64) (err error) {
 	return
 }
 
+// durationTiers are the tiers durations are rounded down within, by steps growing with the durations.
+var durationTiers = []struct {
+	limit, step int
+}{
+	{20, 1},
+	{200, 5},
+	{500, 20},
+	{2000, 50},
+	{20000, 500},
+	{1000000, 10000},
+}
+
+// maxDuration caps the durations beyond the tiers, which are rounded up to powers of 2 below it.
+const maxDuration = 3600 * 1000
+
 func computeDuration(durationInMillis int) int {
 	if durationInMillis < 1 {
 		return 1
-	} else if durationInMillis < 20 {
-		return durationInMillis
-	} else if durationInMillis < 200 {
-		return durationInMillis - durationInMillis%5
-	} else if durationInMillis < 500 {
-		return durationInMillis - durationInMillis%20
-	} else if durationInMillis < 2000 {
-		return durationInMillis - durationInMillis%50
-	} else if durationInMillis < 20000 {
-		return durationInMillis - durationInMillis%500
-	} else if durationInMillis < 1000000 {
-		return durationInMillis - durationInMillis%10000
+	}
+	for _, tier := range durationTiers {
+		if durationInMillis < tier.limit {
+			return durationInMillis - durationInMillis%tier.step
+		}
+	}
+
+	dk := 524288
+	if durationInMillis > maxDuration {
+		dk = maxDuration
 	} else {
-		dk := 524288
-		if durationInMillis > 3600*1000 {
-			dk = 3600 * 1000
-		} else {
-			for dk < durationInMillis {
-				dk <<= 1
-			}
+		for dk < durationInMillis {
+			dk <<= 1
 		}
-		return dk
 	}
+	return dk
 }
 
+// durationBoundaries are the edges of the tiers computeDuration rounds durations within, in milliseconds.
+var durationBoundaries = func() []int64 {
+	boundaries := []int64{1}
+	for _, tier := range durationTiers {
+		boundaries = append(boundaries, int64(tier.limit))
+	}
+	return append(boundaries, maxDuration)
+}()
+
 var aggregator = catLocalAggregator{
 	event:       newEventAggregator(),
 	transaction: newTransactionAggregator(),
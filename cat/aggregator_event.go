@@ -7,17 +7,23 @@ import (
 	"github.com/xiaobudongzhang/cat-go/message"
 )
 
+type eventStats struct {
+	count, fail int
+}
+
 type eventData struct {
 	mtype, name string
 
-	count, fail int
+	// eventStats are sent to the server, of the events which have not been sent themselves.
+	eventStats
+	// observed are exposed to prometheus, of every event seen once the exporter is enabled.
+	observed eventStats
 }
 
 type eventAggregator struct {
 	scheduleMixin
-	ch      chan *message.Event
-	dataMap map[string]*eventData
-	ticker  *time.Ticker
+	data   *ccMap[aggregatorKey, *eventData]
+	ticker *time.Ticker
 }
 
 func (p *eventAggregator) GetName() string {
@@ -25,38 +31,24 @@ func (p *eventAggregator) GetName() string {
 }
 
 func (p *eventAggregator) collectAndSend() {
-	dataMap := p.dataMap
-	p.dataMap = make(map[string]*eventData)
+	dataMap := p.data.drain()
+	exporter.addEvents(dataMap)
 	p.send(dataMap)
 }
 
-func (p *eventAggregator) send(dataMap map[string]*eventData) {
-	if len(dataMap) == 0 {
-		return
-	}
-
-	t := message.NewTransaction(typeSystem, nameEventAggregator, aggregator.flush)
-	defer t.Complete()
+func (p *eventAggregator) send(dataMap map[aggregatorKey]*eventData) {
+	t := newAggregatorTree(nameEventAggregator, aggregator.flush)
+	defer t.complete()
 
 	for _, data := range dataMap {
-		event := t.NewEvent(data.mtype, data.name)
-		event.SetData(fmt.Sprintf("%c%d%c%d", batchFlag, data.count, batchSplit, data.fail))
-	}
-}
-
-func (p *eventAggregator) getOrDefault(event *message.Event) *eventData {
-	key := fmt.Sprintf("%s,%s", event.Type, event.Name)
-
-	if data, ok := p.dataMap[key]; ok {
-		return data
-	} else {
-		p.dataMap[key] = &eventData{
-			mtype: event.Type,
-			name:  event.Name,
-			count: 0,
-			fail:  0,
+		if data.count == 0 {
+			// only observed.
+			continue
 		}
-		return p.dataMap[key]
+
+		event := message.NewEvent(data.mtype, data.name, nil)
+		event.SetData(fmt.Sprintf("%c%d%c%d", batchFlag, data.count, batchSplit, data.fail))
+		t.add(event)
 	}
 }
 
@@ -65,11 +57,6 @@ func (p *eventAggregator) afterStart() {
 }
 
 func (p *eventAggregator) beforeStop() {
-	close(p.ch)
-
-	for event := range p.ch {
-		p.getOrDefault(event).add(event)
-	}
 	p.collectAndSend()
 
 	p.ticker.Stop()
@@ -79,37 +66,52 @@ func (p *eventAggregator) process() {
 	select {
 	case sig := <-p.signals:
 		p.handle(sig)
-	case event := <-p.ch:
-		p.getOrDefault(event).add(event)
 	case <-p.ticker.C:
+		errorLimiter.sweep()
 		p.collectAndSend()
 	}
 }
 
 func (p *eventAggregator) Put(event *message.Event) {
+	p.putSample(event.GetType(), event.GetName(), event.GetStatus() != SUCCESS)
+}
+
+// putSample counts an event in place, from the caller's goroutine.
+func (p *eventAggregator) putSample(mtype, name string, fail bool) {
 	if !IsEnabled() {
 		return
 	}
 
-	select {
-	case p.ch <- event:
-	default:
-		logger.Warning("Event aggregator is full")
-	}
+	p.data.compute(aggregatorKey{mtype, name}, newEventData, func(data *eventData) {
+		data.add(fail)
+	})
+}
+
+// observe counts event for the exporter only, from the caller's goroutine.
+func (p *eventAggregator) observe(event *message.Event) {
+	fail := event.GetStatus() != SUCCESS
+	p.data.compute(aggregatorKey{event.GetType(), event.GetName()}, newEventData, func(data *eventData) {
+		data.observed.add(fail)
+	})
 }
 
-func (data *eventData) add(event *message.Event) {
-	data.count++
+func (s *eventStats) add(fail bool) {
+	s.count++
+	if fail {
+		s.fail++
+	}
+}
 
-	if event.GetStatus() != SUCCESS {
-		data.fail++
+func newEventData(key aggregatorKey) *eventData {
+	return &eventData{
+		mtype: key.mtype,
+		name:  key.name,
 	}
 }
 
 func newEventAggregator() *eventAggregator {
 	return &eventAggregator{
 		scheduleMixin: makeScheduleMixedIn(signalEventAggregatorExit),
-		ch:            make(chan *message.Event, eventAggregatorChannelCapacity),
-		dataMap:       make(map[string]*eventData),
+		data:          newCCMap[aggregatorKey, *eventData](aggregatorShards, aggregatorKey.hash),
 	}
 }
@@ -16,9 +16,8 @@ type metricData struct {
 
 type metricAggregator struct {
 	scheduleMixin
-	ch      chan *metricData
-	dataMap map[string]*metricData
-	ticker  *time.Ticker
+	data   *ccMap[string, *metricData]
+	ticker *time.Ticker
 }
 
 func (p *metricAggregator) GetName() string {
@@ -30,11 +29,6 @@ func (p *metricAggregator) afterStart() {
 }
 
 func (p *metricAggregator) beforeStop() {
-	close(p.ch)
-
-	for event := range p.ch {
-		p.putOrMerge(event)
-	}
 	p.collectAndSend()
 
 	p.ticker.Stop()
@@ -44,26 +38,20 @@ func (p *metricAggregator) process() {
 	select {
 	case sig := <-p.signals:
 		p.handle(sig)
-	case data := <-p.ch:
-		p.putOrMerge(data)
 	case <-p.ticker.C:
 		p.collectAndSend()
 	}
 }
 
 func (p *metricAggregator) collectAndSend() {
-	dataMap := p.dataMap
-	p.dataMap = make(map[string]*metricData)
+	dataMap := p.data.drain()
+	exporter.addMetrics(dataMap)
 	p.send(dataMap)
 }
 
 func (p *metricAggregator) send(dataMap map[string]*metricData) {
-	if len(dataMap) == 0 {
-		return
-	}
-
-	t := message.NewTransaction(typeSystem, nameMetricAggregator, aggregator.flush)
-	defer t.Complete()
+	t := newAggregatorTree(nameMetricAggregator, aggregator.flush)
+	defer t.complete()
 
 	for _, data := range dataMap {
 		metric := message.NewMetric("", data.name, nil)
@@ -77,47 +65,33 @@ func (p *metricAggregator) send(dataMap map[string]*metricData) {
 			metric.SetData(strconv.Itoa(data.count))
 		}
 
-		t.AddChild(metric)
+		t.add(metric)
 	}
 }
 
-func (p *metricAggregator) putOrMerge(data *metricData) {
-	if item, ok := p.dataMap[data.name]; ok {
-		item.count += data.count
-		item.duration += data.duration
-	} else {
-		p.dataMap[data.name] = data
-	}
+// add merges count and duration in place, from the caller's goroutine.
+func (p *metricAggregator) add(name string, count int, duration time.Duration) {
+	p.data.compute(name, newMetricData, func(data *metricData) {
+		data.count += count
+		data.duration += duration
+	})
+}
+
+func newMetricData(name string) *metricData {
+	return &metricData{name: name}
 }
 
 func newMetricAggregator() *metricAggregator {
 	return &metricAggregator{
 		scheduleMixin: makeScheduleMixedIn(signalMetricAggregatorExit),
-		ch:            make(chan *metricData, metricAggregatorChannelCapacity),
-		dataMap:       make(map[string]*metricData),
+		data:          newCCMap[string, *metricData](aggregatorShards, hasher),
 	}
 }
 
 func (p *metricAggregator) AddDuration(name string, duration time.Duration) {
-	select {
-	case p.ch <- &metricData{
-		name:     name,
-		count:    1,
-		duration: duration,
-	}:
-	default:
-		logger.Warning("Metric aggregator is full")
-	}
+	p.add(name, 1, duration)
 }
 
 func (p *metricAggregator) AddCount(name string, count int) {
-	select {
-	case p.ch <- &metricData{
-		name:     name,
-		count:    count,
-		duration: 0,
-	}:
-	default:
-		logger.Warning("Metric aggregator is full")
-	}
+	p.add(name, count, 0)
 }
@@ -0,0 +1,40 @@
+package cat
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/xiaobudongzhang/cat-go/message"
+)
+
+func TestAggregatorTreeLimits(t *testing.T) {
+	// the sender isn't running, the trees are taken from its channel.
+	for len(sender.normal) > 0 {
+		<-sender.normal
+	}
+
+	var keys = message.DefaultMaxChildren*2 + 500
+	dataMap := make(map[aggregatorKey]*eventData, keys)
+	for i := 0; i < keys; i++ {
+		key := aggregatorKey{"Event", strconv.Itoa(i)}
+		data := newEventData(key)
+		data.add(false)
+		dataMap[key] = data
+	}
+	aggregator.event.send(dataMap)
+
+	var trees, children int
+	for len(sender.normal) > 0 {
+		trans := (<-sender.normal).(*message.Transaction)
+		trees++
+		for _, child := range trans.GetChildren() {
+			if child.GetType() == message.TypeTruncated {
+				t.Fatalf("aggregated events have been truncated: %s", child.GetName())
+			}
+			children++
+		}
+	}
+	if trees != 3 || children != keys {
+		t.Errorf("%d events have been sent in %d trees, %d in 3 expected", children, trees, keys)
+	}
+}
@@ -2,15 +2,12 @@ package cat
 
 import (
 	"bytes"
-	"fmt"
 	"time"
 
 	"github.com/xiaobudongzhang/cat-go/message"
 )
 
-type transactionData struct {
-	mtype, name string
-
+type transactionStats struct {
 	count, fail int
 
 	sum int64
@@ -18,6 +15,15 @@ type transactionData struct {
 	durations map[int]int
 }
 
+type transactionData struct {
+	mtype, name string
+
+	// transactionStats are sent to the server, of the transactions which have not been sent themselves.
+	transactionStats
+	// observed are exposed to prometheus, of every transaction seen once the exporter is enabled.
+	observed transactionStats
+}
+
 // noinspection GoUnhandledErrorResult
 func encodeTransactionData(data *transactionData) *bytes.Buffer {
 	buf := newBuf()
@@ -51,48 +57,37 @@ func (p *transactionAggregator) GetName() string {
 
 type transactionAggregator struct {
 	scheduleMixin
-	ch      chan *message.Transaction
-	dataMap map[string]*transactionData
-	ticker  *time.Ticker
+	data   *ccMap[aggregatorKey, *transactionData]
+	ticker *time.Ticker
 }
 
 func (p *transactionAggregator) collectAndSend() {
-	dataMap := p.dataMap
-	p.dataMap = make(map[string]*transactionData)
+	dataMap := p.data.drain()
+	exporter.addTransactions(dataMap)
 	p.send(dataMap)
 }
 
-func (p *transactionAggregator) send(dataMap map[string]*transactionData) {
-	if len(dataMap) == 0 {
-		return
-	}
-
-	t := message.NewTransaction(typeSystem, nameTransactionAggregator, aggregator.flush)
-	defer t.Complete()
+func (p *transactionAggregator) send(dataMap map[aggregatorKey]*transactionData) {
+	t := newAggregatorTree(nameTransactionAggregator, aggregator.flush)
+	defer t.complete()
 
 	for _, data := range dataMap {
+		if data.count == 0 {
+			// only observed.
+			continue
+		}
+
 		trans := message.NewTransaction(data.mtype, data.name, nil)
 		trans.SetData(encodeTransactionData(data).String())
 		trans.Complete()
-		t.AddChild(trans)
+		t.add(trans)
 	}
 }
 
-func (p *transactionAggregator) getOrDefault(transaction *message.Transaction) *transactionData {
-	key := fmt.Sprintf("%s,%s", transaction.Type, transaction.Name)
-
-	if data, ok := p.dataMap[key]; ok {
-		return data
-	} else {
-		p.dataMap[key] = &transactionData{
-			mtype:     transaction.GetType(),
-			name:      transaction.GetName(),
-			count:     0,
-			fail:      0,
-			sum:       0,
-			durations: make(map[int]int),
-		}
-		return p.dataMap[key]
+func newTransactionData(key aggregatorKey) *transactionData {
+	return &transactionData{
+		mtype: key.mtype,
+		name:  key.name,
 	}
 }
 
@@ -101,11 +96,6 @@ func (p *transactionAggregator) afterStart() {
 }
 
 func (p *transactionAggregator) beforeStop() {
-	close(p.ch)
-
-	for t := range p.ch {
-		p.getOrDefault(t).add(t)
-	}
 	p.collectAndSend()
 
 	p.ticker.Stop()
@@ -115,47 +105,50 @@ func (p *transactionAggregator) process() {
 	select {
 	case sig := <-p.signals:
 		p.handle(sig)
-	case t := <-p.ch:
-		p.getOrDefault(t).add(t)
 	case <-p.ticker.C:
 		p.collectAndSend()
 	}
 }
 
+// Put aggregates t in place, from the caller's goroutine.
 func (p *transactionAggregator) Put(t *message.Transaction) {
 	if !IsEnabled() {
 		return
 	}
 
-	select {
-	case p.ch <- t:
-	default:
-		logger.Warning("Transaction aggregator is full")
-	}
+	fail := t.GetStatus() != SUCCESS
+	millis := duration2Millis(t.GetDuration())
+	p.data.compute(aggregatorKey{t.GetType(), t.GetName()}, newTransactionData, func(data *transactionData) {
+		data.add(fail, millis)
+	})
 }
 
-func (data *transactionData) add(transaction *message.Transaction) {
-	data.count++
+// observe counts t for the exporter only, from the caller's goroutine.
+func (p *transactionAggregator) observe(t *message.Transaction) {
+	fail := t.GetStatus() != SUCCESS
+	millis := duration2Millis(t.GetDuration())
+	p.data.compute(aggregatorKey{t.GetType(), t.GetName()}, newTransactionData, func(data *transactionData) {
+		data.observed.add(fail, millis)
+	})
+}
 
-	if transaction.GetStatus() != SUCCESS {
-		data.fail++
-	}
+func (s *transactionStats) add(fail bool, millis int64) {
+	s.count++
 
-	millis := duration2Millis(transaction.GetDuration())
-	data.sum += millis
+	if fail {
+		s.fail++
+	}
 
-	duration := computeDuration(int(millis))
-	if _, ok := data.durations[duration]; ok {
-		data.durations[duration]++
-	} else {
-		data.durations[duration] = 1
+	if s.durations == nil {
+		s.durations = make(map[int]int)
 	}
+	s.sum += millis
+	s.durations[computeDuration(int(millis))]++
 }
 
 func newTransactionAggregator() *transactionAggregator {
 	return &transactionAggregator{
 		scheduleMixin: makeScheduleMixedIn(signalTransactionAggregatorExit),
-		ch:            make(chan *message.Transaction, transactionAggregatorChannelCapacity),
-		dataMap:       make(map[string]*transactionData),
+		data:          newCCMap[aggregatorKey, *transactionData](aggregatorShards, aggregatorKey.hash),
 	}
 }
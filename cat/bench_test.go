@@ -0,0 +1,123 @@
+package cat
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// benchmark enables cat without hooks nor exporter, and drains the channels of the sender which isn't running,
+// releasing the messages as it would.
+func benchmark(b *testing.B) {
+	enable()
+	hooks, _ := Manager.hooks.Load().([]*FlushHook)
+	Manager.hooks.Store([]*FlushHook(nil))
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case m := <-sender.normal:
+				releaseMessage(m)
+			case m := <-sender.high:
+				releaseMessage(m)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	b.Cleanup(func() {
+		close(done)
+		Manager.hooks.Store(hooks)
+		disable()
+	})
+	b.ReportAllocs()
+	b.ResetTimer()
+}
+
+func BenchmarkLogEvent(b *testing.B) {
+	benchmark(b)
+	for i := 0; i < b.N; i++ {
+		LogEvent("Cache", "hit")
+	}
+}
+
+func BenchmarkLogEventFailure(b *testing.B) {
+	benchmark(b)
+	for i := 0; i < b.N; i++ {
+		LogEvent("Cache", "miss", FAIL, "key=foo")
+	}
+}
+
+func BenchmarkNewTransactionComplete(b *testing.B) {
+	benchmark(b)
+	for i := 0; i < b.N; i++ {
+		t := NewTransaction("URL", "/foo")
+		t.Complete()
+	}
+}
+
+func BenchmarkNextId(b *testing.B) {
+	benchmark(b)
+	for i := 0; i < b.N; i++ {
+		_ = Manager.NextId()
+	}
+}
+
+var benchmarkNames = func() []string {
+	var names = make([]string, 16)
+	for i := range names {
+		names[i] = "name-" + strconv.Itoa(i)
+	}
+	return names
+}()
+
+func BenchmarkLogEventParallel(b *testing.B) {
+	benchmark(b)
+	b.RunParallel(func(pb *testing.PB) {
+		var i = 0
+		for pb.Next() {
+			LogEvent("Cache", benchmarkNames[i%len(benchmarkNames)])
+			i++
+		}
+	})
+}
+
+func BenchmarkLogMetricParallel(b *testing.B) {
+	benchmark(b)
+	b.RunParallel(func(pb *testing.PB) {
+		var i = 0
+		for pb.Next() {
+			LogMetricForDuration(benchmarkNames[i%len(benchmarkNames)], time.Millisecond)
+			i++
+		}
+	})
+}
+
+// BenchmarkChannelAggregationParallel aggregates events the way the aggregators used to, through a channel drained
+// by a single goroutine, for comparison with BenchmarkLogEventParallel. The aggregators used to drop the events
+// which didn't fit in the channel, they are waited for here so that every event is aggregated.
+func BenchmarkChannelAggregationParallel(b *testing.B) {
+	var ch = make(chan aggregatorKey, 1000)
+	var done = make(chan struct{})
+	go func() {
+		var counts = make(map[aggregatorKey]int)
+		for key := range ch {
+			counts[key]++
+		}
+		close(done)
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i = 0
+		for pb.Next() {
+			ch <- aggregatorKey{"Cache", benchmarkNames[i%len(benchmarkNames)]}
+			i++
+		}
+	})
+	close(ch)
+	<-done
+}
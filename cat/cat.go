@@ -1,11 +1,13 @@
 package cat
 
 import (
+	"context"
 	"os"
 	"sync/atomic"
 )
 
-var isEnabled uint32 = 0
+// disabled holds the reasons why the client is disabled, it is enabled once there are none.
+var disabled = disabledStopped
 
 func Init(domain string) {
 	InitWithLocation(domain, "")
@@ -16,12 +18,7 @@ func InitWithLocation(domain, location string) {
 		logger.Warning("Cat initialize failed.")
 		return
 	}
-	enable()
-
-	go background(&router)
-	go background(&monitor)
-	go background(&sender)
-	aggregator.Background()
+	start()
 }
 
 func InitWithConfig(domain string, cfg XMLConfig) {
@@ -29,34 +26,81 @@ func InitWithConfig(domain string, cfg XMLConfig) {
 		logger.Warning("Cat initialize failed.")
 		return
 	}
+	start()
+}
+
+func start() {
+	if config.transport != nil {
+		sender.transport = config.transport
+		sender.fixed = true
+		sender.setReady()
+	}
+	loadKillSwitch()
 	enable()
 
 	go background(&router)
 	go background(&monitor)
-	go background(&sender)
+	go background(sender)
 	aggregator.Background()
+
+	// a short-lived process may exit before the messages could have been sent otherwise.
+	if config.shortLived {
+		sender.waitForTransport(config.connectTimeout)
+	}
 }
 
 func enable() {
-	if atomic.SwapUint32(&isEnabled, 1) == 0 {
-		logger.Info("Cat has been enabled.")
-	}
+	setDisabled(disabledStopped, false)
 }
 
 func disable() {
-	if atomic.SwapUint32(&isEnabled, 0) == 1 {
-		logger.Info("Cat has been disabled.")
+	setDisabled(disabledStopped, true)
+}
+
+func setDisabled(reason uint32, on bool) {
+	for {
+		current := atomic.LoadUint32(&disabled)
+		next := current &^ reason
+		if on {
+			next = current | reason
+		}
+		if next == current {
+			return
+		}
+		if atomic.CompareAndSwapUint32(&disabled, current, next) {
+			if current == 0 {
+				logger.Info("Cat has been disabled.")
+			} else if next == 0 {
+				logger.Info("Cat has been enabled.")
+			}
+			return
+		}
 	}
 }
 
+func isDisabledBy(reason uint32) bool {
+	return atomic.LoadUint32(&disabled)&reason != 0
+}
+
 func IsEnabled() bool {
-	return atomic.LoadUint32(&isEnabled) > 0
+	return atomic.LoadUint32(&disabled) == 0
 }
 
 func Shutdown() {
 	scheduler.shutdown()
 }
 
+// Flush sends the transactions, events and metrics aggregated so far, and waits until every message logged
+// before has been written, or ctx is done. Messages are kept queued until a connection has been established.
+func Flush(ctx context.Context) error {
+	if isDisabledBy(disabledStopped) {
+		return nil
+	}
+
+	aggregator.collectAndSend()
+	return sender.flush(ctx)
+}
+
 func DebugOn() {
 	logger.logger.SetOutput(os.Stdout)
 }
@@ -44,7 +44,14 @@ func LogEvent(mtype, name string, args ...string) {
 		return
 	}
 
-	var e = NewEvent(mtype, name)
+	// successful events are only counted by the aggregator, no event is needed unless hooks or the exporter see them.
+	if (len(args) == 0 || args[0] == SUCCESS) && !Manager.hasHooks() && !exporter.isEnabled() {
+		aggregator.event.putSample(mtype, name, false)
+		return
+	}
+
+	// the event isn't given to the caller, it is recycled once handled.
+	var e = message.NewPooledEvent(mtype, name, Manager.flush)
 	if len(args) > 0 {
 		e.SetStatus(args[0])
 	}
@@ -54,12 +61,13 @@ func LogEvent(mtype, name string, args ...string) {
 	e.Complete()
 }
 
+// LogError logs err as an Error event, named by args[0] or else by the concrete type of err.
 func LogError(err error, args ...string) {
 	if !IsEnabled() {
 		return
 	}
 
-	var category = "CAT_ERROR"
+	var category string
 
 	if len(args) > 0 {
 		category = args[0]
@@ -68,13 +76,26 @@ func LogError(err error, args ...string) {
 	LogErrorWithCategory(err, category)
 }
 
+// LogErrorWithCategory logs err as an Error event named category, or by the concrete type of err if it is empty.
+// The data of the event is the stack of err and its causes.
+// Only the first errors of a window having the same category, message and top frame are sent with their stack,
+// see SetErrorLimit.
 func LogErrorWithCategory(err error, category string) {
-	if !IsEnabled() {
+	if !IsEnabled() || err == nil {
+		return
+	}
+	if category == "" {
+		category = errorType(err)
+	}
+
+	var pcs = errorOrCallerStack(2, err)
+	if !errorLimiter.allow(category, err, pcs) {
+		suppressError(category)
 		return
 	}
 
-	var event = NewEvent("Error", category)
-	var buf = newStacktrace(2, err)
+	var event = NewEvent(typeError, category)
+	var buf = formatStacktrace(err, pcs)
 	event.SetStatus(message.CatError)
 	event.SetData(buf.String())
 	event.Complete()
@@ -84,11 +105,11 @@ func LogMetricForCount(name string, args ...int) {
 	if !IsEnabled() {
 		return
 	}
-	if len(args) == 0 {
-		aggregator.metric.AddCount(name, 1)
-	} else {
-		aggregator.metric.AddCount(name, args[0])
+	var count = 1
+	if len(args) > 0 {
+		count = args[0]
 	}
+	aggregator.metric.AddCount(name, count)
 }
 
 func LogMetricForDuration(name string, duration time.Duration) {
@@ -104,3 +125,22 @@ func NewMetricHelper(name string) MetricHelper {
 	}
 	return newMetricHelper(name)
 }
+
+// AddFlushHook adds hook to the hooks called with every message flushed, see FlushHook.
+// It returns a function removing the hook.
+func AddFlushHook(hook FlushHook) (remove func()) {
+	if hook == nil {
+		return func() {}
+	}
+	ref := &hook
+	Manager.addHook(ref)
+	return func() {
+		Manager.removeHook(ref)
+	}
+}
+
+// SetErrorLimit sets how many errors of category having the same message and top frame are sent with their stack
+// per window, the others being counted only. An empty category sets the default limit, a negative limit disables it.
+func SetErrorLimit(category string, limit int, window time.Duration) {
+	errorLimiter.setLimit(category, limit, window)
+}
@@ -4,22 +4,24 @@ import (
 	"sync"
 )
 
-type ccMap struct {
+// ccMap is a concurrent map sharded in buckets, each one locked separately,
+// so that goroutines updating different keys seldom contend.
+type ccMap[K comparable, V any] struct {
 	count   uint32
-	buckets []ccMapBucket
-	hasher  ccMapHasher
+	buckets []ccMapBucket[K, V]
+	hasher  ccMapHasher[K]
 }
 
-type ccMapBucket struct {
+type ccMapBucket[K comparable, V any] struct {
 	mu   sync.Mutex
-	data map[string]interface{}
+	data map[K]V
 }
 
-type ccMapHasher func(name string) uint32
+type ccMapHasher[K comparable] func(key K) uint32
 
-type ccMapCreator func(name string) interface{}
+type ccMapCreator[K comparable, V any] func(key K) V
 
-type ccMapComputer func(interface{}) error
+type ccMapComputer[V any] func(V)
 
 func hasher(name string) uint32 {
 	var h uint32 = 0
@@ -31,40 +33,58 @@ func hasher(name string) uint32 {
 	return h
 }
 
-func newCCMap(count int) *ccMap {
-	var ccmap = &ccMap{
+func newCCMap[K comparable, V any](count int, hasher ccMapHasher[K]) *ccMap[K, V] {
+	var ccmap = &ccMap[K, V]{
 		count:   uint32(count),
-		buckets: make([]ccMapBucket, count),
+		buckets: make([]ccMapBucket[K, V], count),
 		hasher:  hasher,
 	}
 	for i := 0; i < count; i++ {
-		ccmap.buckets[i] = ccMapBucket{
-			mu:   sync.Mutex{},
-			data: make(map[string]interface{}),
-		}
+		ccmap.buckets[i].data = make(map[K]V)
 	}
 	return ccmap
 }
 
-func (p *ccMap) compute(key string, creator ccMapCreator, computer ccMapComputer) (err error) {
+// compute calls computer with the value of key, created by creator if there isn't any, while holding its bucket.
+func (p *ccMap[K, V]) compute(key K, creator ccMapCreator[K, V], computer ccMapComputer[V]) {
 	hash := p.hasher(key)
 	slot := hash % p.count
-	bucket := p.buckets[slot]
+	bucket := &p.buckets[slot]
 
 	bucket.mu.Lock()
 	defer bucket.mu.Unlock()
 
-	return bucket.compute(key, creator, computer)
+	bucket.compute(key, creator, computer)
+}
+
+func (p *ccMapBucket[K, V]) compute(key K, creator ccMapCreator[K, V], computer ccMapComputer[V]) {
+	item, ok := p.data[key]
+	if !ok {
+		item = creator(key)
+		p.data[key] = item
+	}
+	computer(item)
 }
 
-func (p *ccMapBucket) compute(key string, creator ccMapCreator, computer ccMapComputer) (err error) {
-	var item interface{}
-	var ok bool
+// drain empties the map, returning what it contained.
+// The values returned aren't changed by compute anymore, they can be read without locking.
+func (p *ccMap[K, V]) drain() map[K]V {
+	var drained = make(map[K]V)
+	for i := range p.buckets {
+		bucket := &p.buckets[i]
 
-	if item, ok = p.data[key]; !ok {
-		p.data[key] = creator(key)
-		item = p.data[key]
+		bucket.mu.Lock()
+		data := bucket.data
+		if len(data) == 0 {
+			bucket.mu.Unlock()
+			continue
+		}
+		bucket.data = make(map[K]V)
+		bucket.mu.Unlock()
+
+		for key, value := range data {
+			drained[key] = value
+		}
 	}
-	err = computer(item)
-	return
+	return drained
 }
@@ -1,9 +1,40 @@
 package cat
 
 import (
+	"strconv"
+	"sync"
 	"testing"
 )
 
-func TestNewCCMap(t *testing.T) {
-	_ = newCCMap(16)
+func TestCCMap(t *testing.T) {
+	m := newCCMap[string, *int](16, hasher)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				m.compute(strconv.Itoa(j%10), func(string) *int {
+					return new(int)
+				}, func(count *int) {
+					*count++
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	drained := m.drain()
+	if len(drained) != 10 {
+		t.Fatalf("expected 10 keys, got %d", len(drained))
+	}
+	for key, count := range drained {
+		if *count != 800 {
+			t.Errorf("%s: expected 800, got %d", key, *count)
+		}
+	}
+	if len(m.drain()) != 0 {
+		t.Error("the map should be empty once drained")
+	}
 }
@@ -1,6 +1,7 @@
 package cat
 
 import (
+	"net"
 	"strconv"
 	"strings"
 )
@@ -11,6 +12,10 @@ type serverAddress struct {
 	HttpPort int    `json:"http_port"`
 }
 
+func (a serverAddress) String() string {
+	return net.JoinHostPort(a.Host, strconv.Itoa(a.Port))
+}
+
 func resolveServerAddresses(router string) (addresses []serverAddress) {
 	for _, segment := range strings.Split(router, ";") {
 		if len(segment) == 0 {
@@ -1,13 +1,16 @@
 package cat
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"encoding/xml"
 	"io/ioutil"
-	"net"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/xiaobudongzhang/cat-go/message"
 )
 
 type Config struct {
@@ -18,15 +21,92 @@ type Config struct {
 	ipHex         string
 	baseLogDir    string
 	router        string
+	routerFormat  string
 	serverAddress []serverAddress
+	loadBalance   bool
+	tlsConfig     *tls.Config
+	sessionToken  string
+	transport     Transport
+
+	shortLived     bool
+	connectTimeout time.Duration
 }
 
 type XMLConfig struct {
-	Name       xml.Name         `xml:"config"`
-	Env        string           `xml:"env"`
-	Router     string           `xml:"router"`
-	BaseLogDir string           `xml:"base-log-dir"`
-	Servers    XMLConfigServers `xml:"servers"`
+	Name             xml.Name             `xml:"config"`
+	Env              string               `xml:"env"`
+	Router           string               `xml:"router"`
+	RouterFormat     string               `xml:"router-format"`
+	BaseLogDir       string               `xml:"base-log-dir"`
+	LoadBalance      bool                 `xml:"load-balance"`
+	TLS              XMLConfigTLS         `xml:"tls"`
+	SessionToken     string               `xml:"session-token"`
+	Transport        XMLConfigTransport   `xml:"transport"`
+	ErrorLimits      XMLConfigErrorLimits `xml:"error-limits"`
+	TreeLimits       XMLConfigTreeLimits  `xml:"tree-limits"`
+	Ip               XMLConfigIp          `xml:"ip"`
+	Heartbeat        XMLConfigHeartbeat   `xml:"heartbeat"`
+	ShortLived       XMLConfigShortLived  `xml:"short-lived"`
+	PersistMessageId bool                 `xml:"persist-message-id"`
+	Servers          XMLConfigServers     `xml:"servers"`
+}
+
+type XMLConfigTLS struct {
+	Enabled            bool   `xml:"enabled,attr"`
+	CAFile             string `xml:"ca-file"`
+	CertFile           string `xml:"cert-file"`
+	KeyFile            string `xml:"key-file"`
+	ServerName         string `xml:"server-name"`
+	InsecureSkipVerify bool   `xml:"insecure-skip-verify"`
+}
+
+type XMLConfigTransport struct {
+	Type      string `xml:"type,attr"`
+	Path      string `xml:"path,attr"`
+	Url       string `xml:"url,attr"`
+	BatchSize int    `xml:"batch-size,attr"`
+}
+
+// XMLConfigErrorLimits limits the errors sent with their stack per window of seconds, see SetErrorLimit.
+type XMLConfigErrorLimits struct {
+	Limit  int                   `xml:"limit,attr"`
+	Window int                   `xml:"window,attr"`
+	Limits []XMLConfigErrorLimit `xml:"error-limit"`
+}
+
+type XMLConfigErrorLimit struct {
+	Category string `xml:"category,attr"`
+	Limit    int    `xml:"limit,attr"`
+	Window   int    `xml:"window,attr"`
+}
+
+// XMLConfigTreeLimits bounds the children kept per transaction and the messages kept per tree,
+// see message.SetTreeLimits.
+type XMLConfigTreeLimits struct {
+	Children int `xml:"children,attr"`
+	Size     int `xml:"size,attr"`
+}
+
+// XMLConfigIp selects the ip identifying the client, either explicitly or among the addresses of an interface
+// and a cidr, see resolveIp.
+type XMLConfigIp struct {
+	Address    string `xml:"address,attr"`
+	Interface  string `xml:"interface,attr"`
+	Cidr       string `xml:"cidr,attr"`
+	PreferIPv6 bool   `xml:"prefer-ipv6,attr"`
+}
+
+// XMLConfigHeartbeat sets the seconds between heartbeats, and the seconds a heartbeat waits for its collection.
+type XMLConfigHeartbeat struct {
+	Interval int `xml:"interval,attr"`
+	Timeout  int `xml:"timeout,attr"`
+}
+
+// XMLConfigShortLived makes the initialization wait at most ConnectTimeout seconds for the connection to the server,
+// for jobs which would exit before it is established otherwise.
+type XMLConfigShortLived struct {
+	Enabled        bool `xml:"enabled,attr"`
+	ConnectTimeout int  `xml:"connect-timeout,attr"`
 }
 
 type XMLConfigServers struct {
@@ -47,6 +127,7 @@ var config = Config{
 	ipHex:         defaultIpHex,
 	baseLogDir:    defaultLogDir,
 	router:        "",
+	routerFormat:  RouterFormatJson,
 	serverAddress: []serverAddress{},
 }
 
@@ -95,6 +176,8 @@ func parseXMLConfig(data []byte) (err error) {
 }
 
 func loadXmlConfig(c XMLConfig) (err error) {
+	loadIp(c.Ip)
+
 	if len(c.BaseLogDir) > 0 {
 		config.baseLogDir = c.BaseLogDir
 	} else {
@@ -124,6 +207,36 @@ func loadXmlConfig(c XMLConfig) (err error) {
 		config.router = c.Router
 	}
 
+	switch c.RouterFormat {
+	case "":
+	case RouterFormatJson, RouterFormatXml:
+		config.routerFormat = c.RouterFormat
+	default:
+		logger.Warning("Unknown router format %s, %s is requested.", c.RouterFormat, config.routerFormat)
+	}
+
+	config.loadBalance = c.LoadBalance
+	config.sessionToken = c.SessionToken
+
+	if config.tlsConfig, err = buildTLSConfig(c.TLS); err != nil {
+		logger.Error("Invalid tls config: %s", err)
+		return
+	}
+
+	if config.transport, err = newTransport(c.Transport); err != nil {
+		logger.Error("Invalid transport config: %s", err)
+		return
+	}
+
+	loadErrorLimits(c.ErrorLimits)
+	loadTreeLimits(c.TreeLimits)
+	loadShortLived(c.ShortLived)
+	monitor.configure(time.Duration(c.Heartbeat.Interval)*time.Second, time.Duration(c.Heartbeat.Timeout)*time.Second)
+
+	if c.PersistMessageId {
+		Manager.persistIds(config.baseLogDir, config.domain)
+	}
+
 	logger.changeLogFile()
 
 	if c.Router == "" {
@@ -145,6 +258,48 @@ func loadXmlConfig(c XMLConfig) (err error) {
 	return err
 }
 
+func loadIp(c XMLConfigIp) {
+	ip, err := resolveIp(c)
+	if err != nil {
+		config.ip = defaultIp
+		config.ipHex = defaultIpHex
+		logger.Warning("Error while getting local ip, using default ip: %s (%s)", defaultIp, err)
+		return
+	}
+	config.ip = ip2String(ip)
+	config.ipHex = ip2HexString(ip)
+	logger.Info("Local ip has been configured to %s", config.ip)
+}
+
+func loadShortLived(c XMLConfigShortLived) {
+	config.shortLived = c.Enabled
+	config.connectTimeout = time.Duration(c.ConnectTimeout) * time.Second
+	if config.connectTimeout <= 0 {
+		config.connectTimeout = defaultConnectTimeout
+	}
+}
+
+func loadErrorLimits(c XMLConfigErrorLimits) {
+	if c.Limit != 0 {
+		errorLimiter.setLimit("", c.Limit, time.Duration(c.Window)*time.Second)
+	}
+	for _, x := range c.Limits {
+		if x.Category != "" {
+			errorLimiter.setLimit(x.Category, x.Limit, time.Duration(x.Window)*time.Second)
+		}
+	}
+}
+
+func loadTreeLimits(c XMLConfigTreeLimits) {
+	if c.Children == 0 {
+		c.Children = message.DefaultMaxChildren
+	}
+	if c.Size == 0 {
+		c.Size = message.DefaultMaxTreeSize
+	}
+	message.SetTreeLimits(c.Children, c.Size)
+}
+
 func (config *Config) InitWithConfig(domain string, cfg XMLConfig) (err error) {
 
 	config.domain = domain
@@ -157,17 +312,6 @@ func (config *Config) InitWithConfig(domain string, cfg XMLConfig) (err error) {
 		}
 	}()
 
-	var ip net.IP
-	if ip, err = getLocalhostIp(); err != nil {
-		config.ip = defaultIp
-		config.ipHex = defaultIpHex
-		logger.Warning("Error while getting local ip, using default ip: %s", defaultIp)
-	} else {
-		config.ip = ip2String(ip)
-		config.ipHex = ip2HexString(ip)
-		logger.Info("Local ip has been configured to %s", config.ip)
-	}
-
 	if config.hostname, err = os.Hostname(); err != nil {
 		config.hostname = defaultHostname
 		logger.Warning("Error while getting hostname, using default hostname: %s", defaultHostname)
@@ -211,17 +355,6 @@ func (config *Config) Init(domain, location string) (err error) {
 		location += "/client.xml"
 	}
 
-	var ip net.IP
-	if ip, err = getLocalhostIp(); err != nil {
-		config.ip = defaultIp
-		config.ipHex = defaultIpHex
-		logger.Warning("Error while getting local ip, using default ip: %s", defaultIp)
-	} else {
-		config.ip = ip2String(ip)
-		config.ipHex = ip2HexString(ip)
-		logger.Info("Local ip has been configured to %s", config.ip)
-	}
-
 	if config.hostname, err = os.Hostname(); err != nil {
 		config.hostname = defaultHostname
 		logger.Warning("Error while getting hostname, using default hostname: %s", defaultHostname)
@@ -26,10 +26,23 @@ const ( // Declared default values.
 	defaultLogDir  = "/data/applogs/cat"
 )
 
+const (
+	// disabledStopped is set until the client is started, and once it has been shut down.
+	disabledStopped uint32 = 1 << iota
+	// disabledByRouter is set while the router config blocks the client.
+	disabledByRouter
+	// disabledLocally is set by Disable, until Enable is called.
+	disabledLocally
+)
+
 const ( // Declared properties given by the router server.
 	propertySample  = "sample"
 	propertyRouters = "routers"
 	propertyBlock   = "block"
+
+	propertyTypeSample            = "sample."
+	propertyStartTransactionTypes = "startTransactionTypes"
+	propertyMatchTransactionTypes = "matchTransactionTypes"
 )
 
 const (
@@ -37,25 +50,64 @@ const (
 	CatContextParentMessageId  = "_catParentMessageId"
 	CatContextChildMessageId   = "_catChildMessageId"
 	CatContextClientDomainName = "_catClientDomainName"
+	CatContextMessageTree      = "_catMessageTree"
 )
 
 const (
 	highPriorityQueueSize   = 1000
 	normalPriorityQueueSize = 5000
 
-	transactionAggregatorChannelCapacity = 1000
-	eventAggregatorChannelCapacity       = 1000
-	metricAggregatorChannelCapacity      = 1000
+	aggregatorShards = 32
 
 	transactionAggregatorInterval = time.Second * 3
 	eventAggregatorInterval       = time.Second * 3
 	metricAggregatorInterval      = time.Second * 3
+
+	defaultCollectorTimeout = time.Second * 5
+
+	defaultConnectTimeout = time.Second * 5
+
+	defaultHeartbeatInterval = time.Minute
+	defaultHeartbeatTimeout  = time.Second * 30
+
+	defaultErrorLimit       = 10
+	defaultErrorLimitWindow = time.Minute
+	errorLimiterCapacity    = 1000
+
+	promMaxSeries    = 10000
+	promOverflowName = "_other"
+
+	taggedTransactionTimeout  = time.Minute * 10
+	taggedTransactionCapacity = 10000
+
+	// messageIdReserveStep is the count of message ids reserved per write of the mark file.
+	messageIdReserveStep = 1000
+
+	routerDialTimeout   = time.Second
+	routerProbeInterval = time.Minute
+	routerBackoffMin    = time.Second
+	routerBackoffMax    = time.Minute
+
+	httpTransportBatchSize     = 100
+	httpTransportFlushInterval = time.Second
+	httpTransportQueueSize     = 16
+
+	// the transactions of atomic types are sent merged by this count, or at this interval.
+	atomicMergeCount    = 200
+	atomicMergeInterval = time.Second * 30
 )
 
 const ( // Declared a series of reserved type and names.
 	typeSystem = "System"
+	typeError  = "Error"
+
+	// typeMergeTree is the type and name of the transactions merging the ones of atomic types.
+	typeMergeTree = "_CatMergeTree"
 
 	nameReboot = "Reboot"
+	namePanic  = "Panic"
+	nameForked = "Forked"
+	nameTagged = "Tagged"
 
 	nameTransactionAggregator = "TransactionAggregator"
 	nameEventAggregator       = "EventAggregator"
@@ -0,0 +1,169 @@
+package cat
+
+import (
+	"context"
+
+	"github.com/xiaobudongzhang/cat-go/message"
+)
+
+const (
+	typeRemoteCall = "RemoteCall"
+)
+
+type messageTree struct {
+	root          message.Transactor
+	current       message.Transactor
+	messageId     string
+	rootMessageId string
+}
+
+// RemoteContext carries the message ids linking a message tree to the tree of its caller.
+type RemoteContext struct {
+	RootMessageId    string
+	ParentMessageId  string
+	ChildMessageId   string
+	ClientDomainName string
+}
+
+func treeFromContext(ctx context.Context) *messageTree {
+	if ctx == nil {
+		return nil
+	}
+	tree, _ := ctx.Value(CatContextMessageTree).(*messageTree)
+	return tree
+}
+
+// StartTransaction creates a transaction nested in the current transaction of ctx,
+// or the root transaction of a new message tree if there isn't any.
+// The returned context carries the new transaction, which only the root is flushed with once completed.
+func StartTransaction(ctx context.Context, mtype, name string) (context.Context, message.Transactor) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if !IsEnabled() {
+		return ctx, &message.NullTransaction{}
+	}
+
+	if tree := treeFromContext(ctx); tree != nil {
+		parent, ok := tree.current.(*message.Transaction)
+		if !ok {
+			return ctx, &message.NullTransaction{}
+		}
+		t := message.NewTransaction(mtype, name, nil)
+		if parent.TryAddChild(t) {
+			child := *tree
+			child.current = t
+			ctx = context.WithValue(ctx, CatContextMessageTree, &child)
+			// the transaction knows its tree, so that it can be forked.
+			t.SetCtx(ctx)
+			return ctx, t
+		}
+
+		// the parent has already been completed, the transaction is recorded in a tree forked from the parent's one.
+		ctx = forkContext(ctx)
+	}
+
+	var tree = &messageTree{}
+	tree.rootMessageId, _ = ctx.Value(CatContextRootMessageId).(string)
+	tree.messageId, _ = ctx.Value(CatContextChildMessageId).(string)
+	if tree.messageId == "" {
+		tree.messageId = Manager.NextId()
+	}
+
+	// the ids given by the caller belong to this tree only, which the transaction knows so that it can be forked.
+	rootCtx := context.WithValue(ctx, CatContextChildMessageId, tree.messageId)
+	t := message.NewTransactionWithContext(context.WithValue(rootCtx, CatContextMessageTree, tree), mtype, name, Manager.flush)
+	tree.root = t
+	tree.current = t
+
+	ctx = context.WithValue(ctx, CatContextRootMessageId, "")
+	ctx = context.WithValue(ctx, CatContextParentMessageId, "")
+	ctx = context.WithValue(ctx, CatContextChildMessageId, "")
+	return context.WithValue(ctx, CatContextMessageTree, tree), t
+}
+
+// forkContext returns a context which the next message tree started from is forked from the current tree of ctx.
+func forkContext(ctx context.Context) context.Context {
+	remote := LogForkedCall(ctx)
+	return LogRemoteCallServer(context.WithValue(ctx, CatContextMessageTree, (*messageTree)(nil)), remote)
+}
+
+// TransactionFromContext returns the current transaction of ctx, or nil if there isn't any.
+func TransactionFromContext(ctx context.Context) message.Transactor {
+	if tree := treeFromContext(ctx); tree != nil {
+		return tree.current
+	}
+	return nil
+}
+
+// LogRemoteCallClient allocates the message id of the callee's tree and logs it as a RemoteCall event
+// in the current transaction. The returned ids are meant to be sent along with the request.
+func LogRemoteCallClient(ctx context.Context) RemoteContext {
+	return logRemoteCall(ctx, "")
+}
+
+// logRemoteCall allocates the message id of a tree linked to the current tree of ctx,
+// and logs it as a RemoteCall event named name in the current transaction.
+// No id is allocated if the current transaction has already been completed, since the event couldn't be logged.
+func logRemoteCall(ctx context.Context, name string) RemoteContext {
+	var remote = LogForkedCall(ctx)
+
+	tree := treeFromContext(ctx)
+	if tree == nil || !IsEnabled() {
+		return remote
+	}
+
+	childMessageId := Manager.NextId()
+	if current, ok := tree.current.(*message.Transaction); ok {
+		var e = message.NewEvent(typeRemoteCall, name, nil)
+		e.SetData(childMessageId)
+		if !current.TryAddChild(e) {
+			return remote
+		}
+	} else {
+		tree.current.LogEvent(typeRemoteCall, name, SUCCESS, childMessageId)
+	}
+	remote.ChildMessageId = childMessageId
+	return remote
+}
+
+// LogRemoteCallServer returns a context which the next message tree started from will be linked to the caller.
+func LogRemoteCallServer(ctx context.Context, remote RemoteContext) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if remote.RootMessageId != "" {
+		ctx = context.WithValue(ctx, CatContextRootMessageId, remote.RootMessageId)
+	}
+	if remote.ParentMessageId != "" {
+		ctx = context.WithValue(ctx, CatContextParentMessageId, remote.ParentMessageId)
+	}
+	if remote.ChildMessageId != "" {
+		ctx = context.WithValue(ctx, CatContextChildMessageId, remote.ChildMessageId)
+	}
+	if remote.ClientDomainName != "" {
+		ctx = context.WithValue(ctx, CatContextClientDomainName, remote.ClientDomainName)
+	}
+	return ctx
+}
+
+// LogForkedCall returns the ids linking forked message trees to the current tree of ctx.
+// Unlike LogRemoteCallClient, no child message id is allocated: a forked tree gets its own message id,
+// so that many of them, such as every consumer of a queued message, can be linked to the same parent.
+func LogForkedCall(ctx context.Context) RemoteContext {
+	var remote = RemoteContext{
+		ClientDomainName: config.domain,
+	}
+
+	tree := treeFromContext(ctx)
+	if tree == nil || !IsEnabled() {
+		return remote
+	}
+
+	remote.RootMessageId = tree.rootMessageId
+	if remote.RootMessageId == "" {
+		remote.RootMessageId = tree.messageId
+	}
+	remote.ParentMessageId = tree.messageId
+	return remote
+}
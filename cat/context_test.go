@@ -0,0 +1,114 @@
+package cat
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/xiaobudongzhang/cat-go/message"
+)
+
+func TestStartTransactionPropagation(t *testing.T) {
+	enable()
+	defer disable()
+
+	ctx, root := StartTransaction(context.Background(), "URL", "/foo")
+	ctx, call := StartTransaction(ctx, "Call", "remote")
+
+	if TransactionFromContext(ctx) != call {
+		t.Fatal("the current transaction should be the nested one")
+	}
+	if children := root.(*message.Transaction).GetChildren(); len(children) != 1 || children[0] != call {
+		t.Fatal("the nested transaction should be a child of the root")
+	}
+
+	remote := LogRemoteCallClient(ctx)
+	tree := treeFromContext(ctx)
+	if remote.RootMessageId != tree.messageId || remote.ParentMessageId != tree.messageId || remote.ChildMessageId == "" {
+		t.Errorf("unexpected remote context: %+v", remote)
+	}
+
+	// the callee's tree.
+	serverCtx, service := StartTransaction(LogRemoteCallServer(context.Background(), remote), "Service", "remote")
+	header := createHeader(service.GetCtx())
+	if header.MessageId != remote.ChildMessageId || header.ParentMessageId != remote.ParentMessageId || header.RootMessageId != remote.RootMessageId {
+		t.Errorf("unexpected header: %+v", header)
+	}
+
+	// another tree started from the callee's context must not reuse its id.
+	other := NewTransactionWithContext(serverCtx, "Service", "other")
+	if createHeader(other.GetCtx()).MessageId == remote.ChildMessageId {
+		t.Error("message id has been reused")
+	}
+}
+
+func TestLogForkedCall(t *testing.T) {
+	enable()
+	defer disable()
+
+	ctx, _ := StartTransaction(context.Background(), "URL", "/foo")
+	remote := LogForkedCall(ctx)
+	tree := treeFromContext(ctx)
+	if remote.RootMessageId != tree.messageId || remote.ParentMessageId != tree.messageId || remote.ChildMessageId != "" {
+		t.Fatalf("unexpected remote context: %+v", remote)
+	}
+
+	// every forked tree gets its own message id.
+	_, first := StartTransaction(LogRemoteCallServer(context.Background(), remote), "MQ", "first")
+	_, second := StartTransaction(LogRemoteCallServer(context.Background(), remote), "MQ", "second")
+	h1, h2 := createHeader(first.GetCtx()), createHeader(second.GetCtx())
+	if h1.MessageId == h2.MessageId || h1.MessageId == tree.messageId {
+		t.Errorf("forked trees should have distinct ids: %s, %s", h1.MessageId, h2.MessageId)
+	}
+	for _, h := range []*message.Header{h1, h2} {
+		if h.ParentMessageId != tree.messageId || h.RootMessageId != tree.messageId {
+			t.Errorf("unexpected header: %+v", h)
+		}
+	}
+}
+
+func TestStartTransactionFanOut(t *testing.T) {
+	enable()
+	defer disable()
+
+	ctx, root := StartTransaction(context.Background(), "URL", "/foo")
+
+	var wg sync.WaitGroup
+	var late = make(chan message.Transactor, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, worker := StartTransaction(ctx, "Worker", strconv.Itoa(i))
+			worker.LogEvent("Event", "work")
+			worker.AddData("i", strconv.Itoa(i))
+			worker.Complete()
+		}(i)
+	}
+	wg.Wait()
+	root.Complete()
+
+	// workers started once the root has been completed are recorded in trees forked from the root's one.
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, worker := StartTransaction(ctx, "Worker", "late")
+			worker.Complete()
+			late <- worker
+		}()
+	}
+	wg.Wait()
+	close(late)
+
+	if children := root.(*message.Transaction).GetChildren(); len(children) != 10 {
+		t.Errorf("expected 10 children, got %d", len(children))
+	}
+	rootId := createHeader(root.GetCtx()).MessageId
+	for worker := range late {
+		if header := createHeader(worker.GetCtx()); header.ParentMessageId != rootId || header.MessageId == rootId {
+			t.Errorf("late worker should be forked from the root: %+v", header)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package cat
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/xiaobudongzhang/cat-go/message"
+)
+
+type errorLimit struct {
+	// limit is the count of errors sent with their stack per window, a negative one disables limiting.
+	limit  int
+	window time.Duration
+}
+
+type errorRecord struct {
+	category, message, frame string
+
+	start      time.Time
+	window     time.Duration
+	count      int
+	suppressed int
+}
+
+// catErrorLimiter limits the Error events logged for the same category, message and top frame.
+// Within a window, the first errors are sent with their stack, the others are only counted by the event aggregator
+// and summarized by a single Error event once the window has ended.
+type catErrorLimiter struct {
+	mu       sync.Mutex
+	defaults errorLimit
+	limits   map[string]errorLimit
+	records  map[string]*errorRecord
+}
+
+var errorLimiter = newErrorLimiter()
+
+func newErrorLimiter() *catErrorLimiter {
+	return &catErrorLimiter{
+		defaults: errorLimit{limit: defaultErrorLimit, window: defaultErrorLimitWindow},
+		limits:   make(map[string]errorLimit),
+		records:  make(map[string]*errorRecord),
+	}
+}
+
+func (p *catErrorLimiter) setLimit(category string, limit int, window time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if window <= 0 {
+		window = defaultErrorLimitWindow
+	}
+	if category == "" {
+		p.defaults = errorLimit{limit: limit, window: window}
+	} else {
+		p.limits[category] = errorLimit{limit: limit, window: window}
+	}
+}
+
+func (p *catErrorLimiter) limitOf(category string) errorLimit {
+	if limit, ok := p.limits[category]; ok {
+		return limit
+	}
+	return p.defaults
+}
+
+// allow tells if an error raised from pcs should be sent with its stack.
+func (p *catErrorLimiter) allow(category string, err error, pcs []uintptr) bool {
+	var now = time.Now()
+	var summary *errorRecord
+
+	defer func() {
+		if summary != nil {
+			summary.log()
+		}
+	}()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	limit := p.limitOf(category)
+	if limit.limit < 0 {
+		return true
+	}
+
+	frame := topFrame(pcs)
+	key := category + "\x00" + err.Error() + "\x00" + frame
+
+	record, ok := p.records[key]
+	if !ok && len(p.records) >= errorLimiterCapacity {
+		// once full, the errors of new keys are limited together per category, which adds a record at most.
+		key = category + "\x00"
+		record, ok = p.records[key]
+		if !ok {
+			record = &errorRecord{category: category, message: "various errors", frame: "various frames", start: now, window: limit.window}
+			p.records[key] = record
+		}
+	}
+	if !ok {
+		record = &errorRecord{category: category, message: err.Error(), frame: frame, start: now, window: limit.window}
+		p.records[key] = record
+	} else if now.Sub(record.start) >= record.window {
+		if record.suppressed > 0 {
+			var ended = *record
+			summary = &ended
+		}
+		record.start, record.window, record.count, record.suppressed = now, limit.window, 0, 0
+	}
+
+	record.count++
+	if record.count <= limit.limit {
+		return true
+	}
+	record.suppressed++
+	return false
+}
+
+// sweep summarizes and forgets the records whose window has ended.
+func (p *catErrorLimiter) sweep() {
+	var now = time.Now()
+	var summaries []*errorRecord
+
+	p.mu.Lock()
+	for key, record := range p.records {
+		if now.Sub(record.start) >= record.window {
+			if record.suppressed > 0 {
+				summaries = append(summaries, record)
+			}
+			delete(p.records, key)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, record := range summaries {
+		record.log()
+	}
+}
+
+func (record *errorRecord) log() {
+	var event = NewEvent(typeError, record.category)
+	event.SetStatus(message.CatError)
+	event.SetData(fmt.Sprintf("%d errors suppressed in %s: %s\nat %s\n", record.suppressed, record.window, record.message, record.frame))
+	event.Complete()
+}
+
+// suppressError counts an error whose stack isn't sent.
+func suppressError(category string) {
+	var event = message.NewEvent(typeError, category, nil)
+	event.SetStatus(message.CatError)
+	exporter.observe(event)
+	aggregator.event.Put(event)
+}
+
+func topFrame(pcs []uintptr) string {
+	if len(pcs) == 0 {
+		return "unknown"
+	}
+	frame, _ := runtime.CallersFrames(pcs[:1]).Next()
+	return fmt.Sprintf("%s(%s:%d)", frame.Function, trimPath(frame.File), frame.Line)
+}
@@ -0,0 +1,104 @@
+package cat
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestErrorLimiter(t *testing.T) {
+	limiter := newErrorLimiter()
+	limiter.setLimit("", 2, time.Minute)
+	limiter.setLimit("SQL", 1, time.Minute)
+	limiter.setLimit("Unlimited", -1, 0)
+
+	err := errors.New("boom")
+	pcs := errorOrCallerStack(1, err)
+
+	var allowed = 0
+	for i := 0; i < 5; i++ {
+		if limiter.allow("Remote", err, pcs) {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Errorf("expected 2 allowed errors, got %d", allowed)
+	}
+
+	if !limiter.allow("SQL", err, pcs) || limiter.allow("SQL", err, pcs) {
+		t.Error("the limit of the category should apply")
+	}
+	if !limiter.allow("Remote", errors.New("other"), pcs) {
+		t.Error("errors having another message should be limited separately")
+	}
+	if !limiter.allow("Remote", err, errorOrCallerStack(1, err)) {
+		t.Error("errors raised elsewhere should be limited separately")
+	}
+	for i := 0; i < 5; i++ {
+		if !limiter.allow("Unlimited", err, pcs) {
+			t.Fatal("a negative limit should disable limiting")
+		}
+	}
+
+	key := "Remote\x00boom\x00" + topFrame(pcs)
+	if record := limiter.records[key]; record == nil || record.suppressed != 3 {
+		t.Fatalf("suppressed errors should be counted: %+v", record)
+	}
+}
+
+func TestErrorLimiterWindow(t *testing.T) {
+	limiter := newErrorLimiter()
+	limiter.setLimit("", 1, time.Minute)
+
+	err := errors.New("boom")
+	pcs := errorOrCallerStack(1, err)
+	limiter.allow("Remote", err, pcs)
+	limiter.allow("Remote", err, pcs)
+
+	for _, record := range limiter.records {
+		record.start = record.start.Add(-time.Minute)
+	}
+	if !limiter.allow("Remote", err, pcs) {
+		t.Error("a new window should have started")
+	}
+
+	for _, record := range limiter.records {
+		record.start = record.start.Add(-time.Minute)
+	}
+	limiter.sweep()
+	if len(limiter.records) != 0 {
+		t.Error("ended windows should be forgotten")
+	}
+}
+
+func TestErrorLimiterCapacity(t *testing.T) {
+	limiter := newErrorLimiter()
+	limiter.setLimit("", 1, time.Minute)
+
+	pcs := errorOrCallerStack(1, errors.New("boom"))
+	for i := 0; i < errorLimiterCapacity; i++ {
+		limiter.allow("Remote", fmt.Errorf("boom %d", i), pcs)
+	}
+
+	var allowed = 0
+	for i := 0; i < 5; i++ {
+		if limiter.allow("Remote", fmt.Errorf("overflow %d", i), pcs) {
+			allowed++
+		}
+	}
+	if allowed != 1 {
+		t.Errorf("errors beyond the capacity should be limited together, %d allowed", allowed)
+	}
+	if record := limiter.records["Remote\x00"]; record == nil || record.suppressed != 4 {
+		t.Fatalf("errors beyond the capacity should be counted: %+v", record)
+	}
+}
+
+func TestTopFrame(t *testing.T) {
+	frame := topFrame(errorOrCallerStack(1, errors.New("boom")))
+	if !strings.HasPrefix(frame, "github.com/xiaobudongzhang/cat-go/cat.TestTopFrame(") {
+		t.Errorf("unexpected top frame: %s", frame)
+	}
+}
@@ -0,0 +1,142 @@
+package cat
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/xiaobudongzhang/cat-go/message"
+)
+
+// Fork starts the root transaction of a tree forked from the current tree of ctx, for work done asynchronously,
+// such as in a goroutine. The forked tree gets a fresh message id, logged as a RemoteCall event named Forked in the
+// current transaction so that the logview of the current tree links to it.
+// The returned transaction is to be completed by the asynchronous work, with the returned context.
+//
+//	ctx, t := cat.Fork(ctx, "Worker", "resize")
+//	go func() {
+//		defer t.Complete()
+//		resize(ctx, image)
+//	}()
+func Fork(ctx context.Context, mtype, name string) (context.Context, message.Transactor) {
+	if treeFromContext(ctx) != nil {
+		remote := logRemoteCall(ctx, nameForked)
+		ctx = LogRemoteCallServer(context.WithValue(ctx, CatContextMessageTree, (*messageTree)(nil)), remote)
+	}
+	return StartTransaction(ctx, mtype, name)
+}
+
+// StartTaggedTransaction does the same as StartTransaction, and tags the new transaction so that the trees of the
+// work it triggers and which is resumed later, such as a delayed job, can be linked to it with Bind.
+// A tag can be bound until it is forgotten, ten minutes after it has been started, even once the tagged transaction
+// has been completed: the trees are still linked to it then, but no Tagged event is logged in it anymore.
+func StartTaggedTransaction(ctx context.Context, mtype, name, tag string) (context.Context, message.Transactor) {
+	ctx, t := StartTransaction(ctx, mtype, name)
+	if tag == "" {
+		return ctx, t
+	}
+	if trans, ok := t.(*message.Transaction); ok {
+		tags.add(tag, trans, LogForkedCall(ctx))
+	}
+	return ctx, t
+}
+
+// Bind returns a context which the next message tree started from is linked to the transaction tagged with tag,
+// which logs the id of the tree as a RemoteCall event named Tagged unless it has been completed.
+// The context is returned unchanged if no transaction is tagged with tag.
+func Bind(ctx context.Context, tag string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if !IsEnabled() {
+		return ctx
+	}
+	trans, remote, ok := tags.get(tag)
+	if !ok {
+		return ctx
+	}
+
+	remote.ChildMessageId = Manager.NextId()
+	if trans != nil {
+		var e = message.NewEvent(typeRemoteCall, nameTagged, nil)
+		e.SetData(remote.ChildMessageId)
+		trans.TryAddChild(e)
+	}
+	return LogRemoteCallServer(context.WithValue(ctx, CatContextMessageTree, (*messageTree)(nil)), remote)
+}
+
+// taggedTransaction keeps the ids linking to a tagged transaction until it expires,
+// and the transaction to log the links in until it is completed.
+type taggedTransaction struct {
+	trans   *message.Transaction
+	remote  RemoteContext
+	expires time.Time
+}
+
+type taggedTransactions struct {
+	mu      sync.Mutex
+	entries map[string]taggedTransaction
+}
+
+var tags = taggedTransactions{
+	entries: make(map[string]taggedTransaction),
+}
+
+func (p *taggedTransactions) add(tag string, trans *message.Transaction, remote RemoteContext) {
+	var now = time.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.entries) >= taggedTransactionCapacity {
+		p.expire(now)
+		if len(p.entries) >= taggedTransactionCapacity {
+			logger.Warning("Too many tagged transactions, %s has been discarded.", tag)
+			return
+		}
+	}
+	// the transaction is registered before its completion can remove it.
+	p.entries[tag] = taggedTransaction{trans: trans, remote: remote, expires: now.Add(taggedTransactionTimeout)}
+	if !trans.OnComplete(func(message.Messager) { p.complete(tag, trans) }) {
+		delete(p.entries, tag)
+	}
+}
+
+func (p *taggedTransactions) get(tag string) (*message.Transaction, RemoteContext, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry, ok := p.entries[tag]
+	if !ok {
+		return nil, RemoteContext{}, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(p.entries, tag)
+		return nil, RemoteContext{}, false
+	}
+	return entry.trans, entry.remote, true
+}
+
+// complete releases the transaction tagged with tag once it is completed, keeping the ids linking to it,
+// unless tag has been given to another transaction since.
+func (p *taggedTransactions) complete(tag string, trans *message.Transaction) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if entry, ok := p.entries[tag]; ok && entry.trans == trans {
+		entry.trans = nil
+		p.entries[tag] = entry
+	}
+}
+
+func (p *taggedTransactions) expire(now time.Time) {
+	for tag, entry := range p.entries {
+		if now.After(entry.expires) {
+			delete(p.entries, tag)
+		}
+	}
+}
+
+func init() {
+	message.Forker = Fork
+}
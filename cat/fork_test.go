@@ -0,0 +1,133 @@
+package cat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/xiaobudongzhang/cat-go/message"
+)
+
+func TestFork(t *testing.T) {
+	enable()
+	defer disable()
+
+	ctx, root := StartTransaction(context.Background(), "URL", "/foo")
+	forkedCtx, forked := Fork(ctx, "Worker", "resize")
+	root.Complete()
+
+	children := root.(*message.Transaction).GetChildren()
+	if len(children) != 1 || children[0].GetType() != typeRemoteCall || children[0].GetName() != nameForked {
+		t.Fatalf("a link event should have been logged: %+v", children)
+	}
+
+	// the forked tree outlives the root.
+	_, nested := StartTransaction(forkedCtx, "Worker", "step")
+	nested.Complete()
+	forked.Complete()
+
+	rootId := createHeader(root.GetCtx()).MessageId
+	header := createHeader(forked.GetCtx())
+	if header.MessageId != children[0].GetData().String() || header.ParentMessageId != rootId || header.RootMessageId != rootId {
+		t.Errorf("unexpected forked header: %+v", header)
+	}
+	if c := forked.(*message.Transaction).GetChildren(); len(c) != 1 || c[0] != nested {
+		t.Error("transactions started from the forked context should be nested in the forked transaction")
+	}
+}
+
+func TestForkWithoutTree(t *testing.T) {
+	enable()
+	defer disable()
+
+	_, forked := Fork(context.Background(), "Worker", "resize")
+	if header := createHeader(forked.GetCtx()); header.MessageId == "" || header.ParentMessageId != "" {
+		t.Errorf("a fork without tree should start a new tree: %+v", header)
+	}
+}
+
+func TestTaggedTransaction(t *testing.T) {
+	enable()
+	defer disable()
+
+	ctx, root := StartTransaction(context.Background(), "URL", "/order")
+	_, tagged := StartTaggedTransaction(ctx, "Job", "schedule", "order-42")
+
+	// the job is resumed later, elsewhere.
+	_, job := StartTransaction(Bind(context.Background(), "order-42"), "Job", "run")
+	job.Complete()
+	tagged.Complete()
+	root.Complete()
+
+	children := tagged.(*message.Transaction).GetChildren()
+	if len(children) != 1 || children[0].GetName() != nameTagged {
+		t.Fatalf("a link event should have been logged in the tagged transaction: %+v", children)
+	}
+	rootId := createHeader(root.GetCtx()).MessageId
+	header := createHeader(job.GetCtx())
+	if header.MessageId != children[0].GetData().String() || header.ParentMessageId != rootId || header.RootMessageId != rootId {
+		t.Errorf("unexpected job header: %+v", header)
+	}
+
+	// once the tagged transaction is completed, its tag is still linked to, without logging in it.
+	_, late := StartTransaction(Bind(context.Background(), "order-42"), "Job", "retry")
+	late.Complete()
+	if header := createHeader(late.GetCtx()); header.ParentMessageId != rootId || header.RootMessageId != rootId {
+		t.Errorf("the tag should be bound once the tagged transaction has been completed: %+v", header)
+	}
+	if len(tagged.(*message.Transaction).GetChildren()) != 1 {
+		t.Error("no link event should be logged in a completed transaction")
+	}
+	tags.mu.Lock()
+	delete(tags.entries, "order-42")
+	tags.mu.Unlock()
+
+	if _, unknown := StartTransaction(Bind(context.Background(), "unknown"), "Job", "run"); createHeader(unknown.GetCtx()).ParentMessageId != "" {
+		t.Error("unknown tags should not be linked")
+	}
+}
+
+func TestTaggedTransactionsExpire(t *testing.T) {
+	var registry = taggedTransactions{entries: make(map[string]taggedTransaction)}
+	trans := message.NewTransaction("Job", "schedule", nil)
+	registry.add("tag", trans, RemoteContext{})
+	if _, _, ok := registry.get("tag"); !ok {
+		t.Fatal("the tag should be registered")
+	}
+
+	registry.entries["tag"] = taggedTransaction{trans: trans, expires: time.Now().Add(-time.Second)}
+	if _, _, ok := registry.get("tag"); ok || len(registry.entries) != 0 {
+		t.Error("expired tags should be forgotten")
+	}
+
+	trans.Complete()
+	registry.add("tag", trans, RemoteContext{})
+	if len(registry.entries) != 0 {
+		t.Error("completed transactions should not be tagged")
+	}
+}
+
+func TestTransactionFork(t *testing.T) {
+	enable()
+	defer disable()
+
+	ctx, root := StartTransaction(context.Background(), "URL", "/foo")
+	_, nested := StartTransaction(ctx, "Service", "resize")
+	forkedCtx, forked := nested.Fork("Worker", "resize")
+	nested.Complete()
+	root.Complete()
+
+	children := nested.(*message.Transaction).GetChildren()
+	if len(children) != 1 || children[0].GetName() != nameForked {
+		t.Fatalf("a link event should have been logged in the forking transaction: %+v", children)
+	}
+	rootId := createHeader(root.GetCtx()).MessageId
+	header := createHeader(forked.GetCtx())
+	if header.MessageId != children[0].GetData().String() || header.ParentMessageId != rootId || header.RootMessageId != rootId {
+		t.Errorf("unexpected forked header: %+v", header)
+	}
+	if TransactionFromContext(forkedCtx) != forked {
+		t.Error("the returned context should carry the forked transaction")
+	}
+	forked.Complete()
+}
@@ -0,0 +1,118 @@
+package cat
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+// localAddress is an address of an up interface.
+type localAddress struct {
+	iface string
+	ip    net.IP
+}
+
+func localAddresses() (addrs []localAddress, err error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return
+	}
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		ifaddrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range ifaddrs {
+			if ipnet, ok := addr.(*net.IPNet); ok {
+				addrs = append(addrs, localAddress{iface: iface.Name, ip: ipnet.IP})
+			}
+		}
+	}
+	return addrs, nil
+}
+
+// resolveIp returns the ip identifying the client, overridden by the CAT_IP, CAT_IP_INTERFACE and CAT_IP_CIDR
+// environment variables:
+// an explicit address is used as is, otherwise an address of the local interfaces is selected, see selectIp.
+func resolveIp(c XMLConfigIp) (net.IP, error) {
+	if v := os.Getenv("CAT_IP"); v != "" {
+		c.Address = v
+	}
+	if v := os.Getenv("CAT_IP_INTERFACE"); v != "" {
+		c.Interface = v
+	}
+	if v := os.Getenv("CAT_IP_CIDR"); v != "" {
+		c.Cidr = v
+	}
+
+	if c.Address != "" {
+		if ip := net.ParseIP(c.Address); ip != nil {
+			return ip, nil
+		}
+		logger.Warning("Invalid ip `%s`, selecting a local address instead.", c.Address)
+	}
+
+	addrs, err := localAddresses()
+	if err != nil {
+		return nil, err
+	}
+	return selectIp(addrs, c)
+}
+
+// selectIp selects the first address of the interface within the cidr, skipping loopback and link-local addresses.
+// An IPv4 address is preferred to an IPv6 one, unless told otherwise.
+// An interface or a cidr matching none of the addresses is ignored.
+func selectIp(addrs []localAddress, c XMLConfigIp) (net.IP, error) {
+	candidates := addrs
+	if c.Interface != "" {
+		candidates = nil
+		for _, addr := range addrs {
+			if addr.iface == c.Interface {
+				candidates = append(candidates, addr)
+			}
+		}
+		if len(candidates) == 0 {
+			logger.Warning("No address found on interface `%s`, selecting among all interfaces.", c.Interface)
+			candidates = addrs
+		}
+	}
+
+	if c.Cidr != "" {
+		if _, network, err := net.ParseCIDR(c.Cidr); err != nil {
+			logger.Warning("Invalid cidr `%s`, ignored.", c.Cidr)
+		} else {
+			var filtered []localAddress
+			for _, addr := range candidates {
+				if network.Contains(addr.ip) {
+					filtered = append(filtered, addr)
+				}
+			}
+			if len(filtered) == 0 {
+				logger.Warning("No local address within `%s`, ignored.", c.Cidr)
+			} else {
+				candidates = filtered
+			}
+		}
+	}
+
+	var fallback net.IP
+	for _, addr := range candidates {
+		if addr.ip.IsLoopback() || addr.ip.IsLinkLocalUnicast() {
+			continue
+		}
+		if (addr.ip.To4() == nil) == c.PreferIPv6 {
+			return addr.ip, nil
+		}
+		if fallback == nil {
+			fallback = addr.ip
+		}
+	}
+	if fallback == nil {
+		return nil, errors.New("no usable local address")
+	}
+	return fallback, nil
+}
@@ -0,0 +1,73 @@
+package cat
+
+import (
+	"net"
+	"testing"
+)
+
+var addrs = []localAddress{
+	{iface: "lo", ip: net.ParseIP("127.0.0.1")},
+	{iface: "lo", ip: net.ParseIP("::1")},
+	{iface: "eth0", ip: net.ParseIP("fe80::1")},
+	{iface: "eth0", ip: net.ParseIP("2001:db8::10")},
+	{iface: "eth0", ip: net.ParseIP("10.0.0.10")},
+	{iface: "eth1", ip: net.ParseIP("192.168.1.10")},
+}
+
+func TestSelectIp(t *testing.T) {
+	cases := []struct {
+		config   XMLConfigIp
+		expected string
+	}{
+		{XMLConfigIp{}, "10.0.0.10"},
+		{XMLConfigIp{PreferIPv6: true}, "2001:db8::10"},
+		{XMLConfigIp{Interface: "eth1"}, "192.168.1.10"},
+		{XMLConfigIp{Interface: "eth1", PreferIPv6: true}, "192.168.1.10"},
+		{XMLConfigIp{Cidr: "192.168.0.0/16"}, "192.168.1.10"},
+		{XMLConfigIp{Cidr: "2001:db8::/32"}, "2001:db8::10"},
+		{XMLConfigIp{Interface: "eth2"}, "10.0.0.10"},
+		{XMLConfigIp{Interface: "eth1", Cidr: "10.0.0.0/8"}, "192.168.1.10"},
+		{XMLConfigIp{Cidr: "invalid"}, "10.0.0.10"},
+	}
+	for _, c := range cases {
+		ip, err := selectIp(addrs, c.config)
+		if err != nil || ip.String() != c.expected {
+			t.Errorf("%+v: expected %s, got %s (%v)", c.config, c.expected, ip, err)
+		}
+	}
+
+	if ip, err := selectIp(addrs[:3], XMLConfigIp{}); err == nil {
+		t.Errorf("loopback and link-local addresses should not be selected: %s", ip)
+	}
+}
+
+func TestResolveIp(t *testing.T) {
+	ip, err := resolveIp(XMLConfigIp{Address: "2001:db8::1"})
+	if err != nil || ip.String() != "2001:db8::1" {
+		t.Errorf("the explicit address should be used: %s (%v)", ip, err)
+	}
+
+	t.Setenv("CAT_IP", "10.1.2.3")
+	if ip, _ := resolveIp(XMLConfigIp{Address: "2001:db8::1"}); ip.String() != "10.1.2.3" {
+		t.Errorf("the environment should override the config: %s", ip)
+	}
+}
+
+func TestIp2String(t *testing.T) {
+	cases := []struct {
+		ip, str, hex string
+	}{
+		{"10.0.0.1", "10.0.0.1", "0a000001"},
+		{"::ffff:10.0.0.1", "10.0.0.1", "0a000001"},
+		{"2001:db8::1", "2001:db8::1", "20010db8000000000000000000000001"},
+	}
+	for _, c := range cases {
+		ip := net.ParseIP(c.ip)
+		if s := ip2String(ip); s != c.str {
+			t.Errorf("%s: expected %s, got %s", c.ip, c.str, s)
+		}
+		if s := ip2HexString(ip); s != c.hex {
+			t.Errorf("%s: expected %s, got %s", c.ip, c.hex, s)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package cat
+
+import (
+	"os"
+	"strconv"
+)
+
+// Disable turns the client off locally, for instance during an incident, until Enable is called.
+// Unlike the block pushed by the router, it is never lifted by the router.
+func Disable(reason string) {
+	logger.Warning("Cat has been disabled locally: %s", reason)
+	setDisabled(disabledLocally, true)
+}
+
+// Enable lifts Disable, the client remaining disabled while the router blocks it.
+func Enable() {
+	logger.Info("Cat has been enabled locally.")
+	setDisabled(disabledLocally, false)
+	if isDisabledBy(disabledByRouter) {
+		logger.Info("Cat is still blocked by the router.")
+	}
+}
+
+func toggleLocally(reason string) {
+	if isDisabledBy(disabledLocally) {
+		Enable()
+	} else {
+		Disable(reason)
+	}
+}
+
+// loadKillSwitch disables the client if the CAT_DISABLED environment variable is set to anything but false.
+// The client is toggled on SIGUSR2 as well where there is such a signal, unless CAT_KILL_SWITCH_SIGNAL is set to false
+// for the application to handle the signal itself.
+func loadKillSwitch() {
+	if v := os.Getenv("CAT_DISABLED"); v != "" {
+		if off, err := strconv.ParseBool(v); err != nil || off {
+			Disable("CAT_DISABLED is set")
+		}
+	}
+	if killSwitchSignal() {
+		watchKillSwitch()
+	}
+}
+
+// killSwitchSignal tells if the client is to be toggled on SIGUSR2, which it is unless CAT_KILL_SWITCH_SIGNAL is false.
+func killSwitchSignal() bool {
+	if v := os.Getenv("CAT_KILL_SWITCH_SIGNAL"); v != "" {
+		if on, err := strconv.ParseBool(v); err == nil {
+			return on
+		}
+	}
+	return true
+}
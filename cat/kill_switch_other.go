@@ -0,0 +1,5 @@
+//go:build !(aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris)
+
+package cat
+
+func watchKillSwitch() {}
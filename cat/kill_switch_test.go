@@ -0,0 +1,73 @@
+package cat
+
+import (
+	"testing"
+)
+
+func TestKillSwitch(t *testing.T) {
+	enable()
+	defer func() {
+		setDisabled(disabledByRouter|disabledLocally, false)
+		disable()
+	}()
+
+	Disable("incident")
+	if IsEnabled() {
+		t.Fatal("the client should be disabled locally")
+	}
+
+	// the router doesn't lift a local block.
+	router.updateBlock("false")
+	if IsEnabled() {
+		t.Fatal("the router should not enable a client disabled locally")
+	}
+
+	router.updateBlock("true")
+	Enable()
+	if IsEnabled() {
+		t.Fatal("the client should still be blocked by the router")
+	}
+
+	router.updateBlock("false")
+	if !IsEnabled() {
+		t.Fatal("the client should have been enabled")
+	}
+
+	toggleLocally("test")
+	if IsEnabled() {
+		t.Fatal("the switch should have turned the client off")
+	}
+	toggleLocally("test")
+	if !IsEnabled() {
+		t.Fatal("the switch should have turned the client on")
+	}
+}
+
+func TestKillSwitchEnv(t *testing.T) {
+	enable()
+	defer func() {
+		setDisabled(disabledLocally, false)
+		disable()
+	}()
+
+	t.Setenv("CAT_DISABLED", "false")
+	loadKillSwitch()
+	if !IsEnabled() {
+		t.Fatal("CAT_DISABLED=false should not disable the client")
+	}
+
+	t.Setenv("CAT_DISABLED", "1")
+	loadKillSwitch()
+	if IsEnabled() {
+		t.Fatal("CAT_DISABLED should disable the client")
+	}
+}
+
+func TestKillSwitchSignalOptOut(t *testing.T) {
+	for v, expected := range map[string]bool{"": true, "true": true, "yes": true, "false": false, "0": false} {
+		t.Setenv("CAT_KILL_SWITCH_SIGNAL", v)
+		if killSwitchSignal() != expected {
+			t.Errorf("CAT_KILL_SWITCH_SIGNAL=%q should watch SIGUSR2: %t", v, expected)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+
+package cat
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+var watchOnce sync.Once
+
+func watchKillSwitch() {
+	watchOnce.Do(func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGUSR2)
+		go func() {
+			for range signals {
+				toggleLocally("SIGUSR2 has been received")
+			}
+		}()
+	})
+}
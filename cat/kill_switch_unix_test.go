@@ -0,0 +1,30 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+
+package cat
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestKillSwitchSignal(t *testing.T) {
+	enable()
+	defer func() {
+		setDisabled(disabledLocally, false)
+		disable()
+	}()
+
+	loadKillSwitch()
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for IsEnabled() {
+		if time.Now().After(deadline) {
+			t.Fatal("SIGUSR2 should have disabled the client")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
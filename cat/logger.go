@@ -7,6 +7,8 @@ import (
 	"os"
 	"sync"
 	"time"
+
+	"github.com/xiaobudongzhang/cat-go/message"
 )
 
 type Logger struct {
@@ -95,3 +97,7 @@ func (l *Logger) Error(format string, args ...interface{}) {
 }
 
 var logger = createLogger()
+
+func init() {
+	message.Warn = logger.Warning
+}
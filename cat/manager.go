@@ -1,18 +1,73 @@
 package cat
 
 import (
-	"fmt"
+	"sync"
 	"sync/atomic"
-	"time"
 
 	"github.com/xiaobudongzhang/cat-go/message"
 )
 
+// FlushHook is called with every message flushed by the Manager, before it is sampled, aggregated or sent.
+// Hooks are called synchronously, they should be fast and must not modify the message.
+// The events logged with LogEvent are recycled once handled, hooks must not keep them.
+type FlushHook func(m message.Messager)
+
 type catMessageManager struct {
-	index           uint32
-	offset          uint32
-	hour            int
-	messageIdPrefix string
+	offset uint32
+
+	// ids holds the *messageIdState of the current hour, replaced under idsMu.
+	idsMu sync.Mutex
+	ids   atomic.Value
+	mark  string
+
+	hooksMu sync.Mutex
+	hooks   atomic.Value
+}
+
+// addHook adds hook, held through a pointer so that removeHook can tell it apart from the same func added twice.
+func (p *catMessageManager) addHook(hook *FlushHook) {
+	p.hooksMu.Lock()
+	defer p.hooksMu.Unlock()
+
+	hooks, _ := p.hooks.Load().([]*FlushHook)
+	newHooks := make([]*FlushHook, len(hooks), len(hooks)+1)
+	copy(newHooks, hooks)
+	p.hooks.Store(append(newHooks, hook))
+}
+
+func (p *catMessageManager) removeHook(hook *FlushHook) {
+	p.hooksMu.Lock()
+	defer p.hooksMu.Unlock()
+
+	hooks, _ := p.hooks.Load().([]*FlushHook)
+	newHooks := make([]*FlushHook, 0, len(hooks))
+	for _, h := range hooks {
+		if h != hook {
+			newHooks = append(newHooks, h)
+		}
+	}
+	p.hooks.Store(newHooks)
+}
+
+func (p *catMessageManager) hasHooks() bool {
+	hooks, _ := p.hooks.Load().([]*FlushHook)
+	return len(hooks) > 0
+}
+
+func (p *catMessageManager) callHooks(m message.Messager) {
+	hooks, _ := p.hooks.Load().([]*FlushHook)
+	for _, hook := range hooks {
+		p.callHook(*hook, m)
+	}
+}
+
+func (p *catMessageManager) callHook(hook FlushHook, m message.Messager) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Error("Flush hook panicked: %v", err)
+		}
+	}()
+	hook(m)
 }
 
 func (p *catMessageManager) sendTransaction(t *message.Transaction) {
@@ -24,14 +79,20 @@ func (p *catMessageManager) sendEvent(t *message.Event) {
 }
 
 func (p *catMessageManager) flush(m message.Messager) {
+	p.callHooks(m)
+	exporter.observe(m)
+
 	switch m := m.(type) {
 	case *message.Transaction:
-		if m.Status != SUCCESS {
-			sender.handleTransaction(m)
-		} else if p.hitSample(router.sample) {
+		policy := router.policy()
+		if m.GetStatus() != SUCCESS {
 			sender.handleTransaction(m)
-		} else {
+		} else if !p.sample(policy, m.GetType()) {
 			aggregator.transaction.Put(m)
+		} else if policy.isAtomic(m.GetType()) {
+			sender.handleAtomicTransaction(m)
+		} else {
+			sender.handleTransaction(m)
 		}
 	case *message.Heartbeat:
 		sender.handleHeartbeat(m)
@@ -40,49 +101,13 @@ func (p *catMessageManager) flush(m message.Messager) {
 			sender.handleEvent(m)
 		} else {
 			aggregator.event.Put(m)
+			m.Release()
 		}
 	default:
 		logger.Warning("Unrecognized message type.")
 	}
 }
 
-func (p *catMessageManager) hitSample(sampleRate float64) bool {
-	if sampleRate > 1.0 {
-		return true
-	} else if sampleRate < 1e-9 {
-		return false
-	}
-	var cycle = uint32(1 / sampleRate)
-
-	var current, next uint32
-	for {
-		current = atomic.LoadUint32(&p.offset)
-		next = (current + 1) % cycle
-		if atomic.CompareAndSwapUint32(&p.offset, current, next) {
-			break
-		}
-	}
-	return next == 0
-}
-
-func (p *catMessageManager) NextId() string {
-	hour := int(time.Now().Unix() / 3600)
-
-	if hour != p.hour {
-		p.hour = hour
-		p.messageIdPrefix = fmt.Sprintf("%s-%s-%d", config.domain, config.ipHex, hour)
-
-		currentIndex := atomic.LoadUint32(&p.index)
-		if atomic.CompareAndSwapUint32(&p.index, currentIndex, 0) {
-			logger.Info("MessageId prefix has changed to: %s", p.messageIdPrefix)
-		}
-	}
-
-	return fmt.Sprintf("%s-%d", p.messageIdPrefix, atomic.AddUint32(&p.index, 1))
-}
-
 var Manager = catMessageManager{
-	index:  0,
 	offset: 0,
-	hour:   0,
 }
@@ -9,10 +9,11 @@ func TestHitSample(t *testing.T) {
 		total  = 100000
 		sample = 0.01
 		count  = 0
+		offset uint32
 	)
 
 	for i := 0; i < total; i++ {
-		if manager.hitSample(sample) {
+		if hitSample(&offset, sample) {
 			count++
 		}
 	}
@@ -0,0 +1,121 @@
+package cat
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// messageIdState issues the message ids of an hour, <domain>-<ip>-<hour>-<index>.
+// Once an hour is over, its state is replaced rather than reset, so that callers still holding it
+// keep issuing ids of the past hour, which can't collide with the ids of the new one.
+type messageIdState struct {
+	hour   int
+	prefix string
+	index  uint32
+
+	// mark is the file persisting reserved, the index up to which ids may be issued, or empty if ids aren't persisted.
+	mark     string
+	reserved uint32
+}
+
+func (p *catMessageManager) NextId() string {
+	return p.nextId(int(time.Now().Unix() / 3600))
+}
+
+func (p *catMessageManager) nextId(hour int) string {
+	state, _ := p.ids.Load().(*messageIdState)
+	if state == nil || state.hour < hour {
+		state = p.rollover(hour)
+	}
+
+	index := atomic.AddUint32(&state.index, 1)
+	if state.mark != "" && index > atomic.LoadUint32(&state.reserved) {
+		p.reserve(state, index)
+	}
+	return state.prefix + strconv.FormatUint(uint64(index), 10)
+}
+
+// rollover returns the state of hour, unless the current state is of a later hour already.
+func (p *catMessageManager) rollover(hour int) *messageIdState {
+	p.idsMu.Lock()
+	defer p.idsMu.Unlock()
+
+	if current, _ := p.ids.Load().(*messageIdState); current != nil && current.hour >= hour {
+		return current
+	}
+
+	var state = &messageIdState{
+		hour:   hour,
+		prefix: config.domain + "-" + config.ipHex + "-" + strconv.Itoa(hour) + "-",
+		mark:   p.mark,
+	}
+	if state.mark != "" {
+		// ids issued before a restart within the same hour are skipped.
+		if markHour, reserved, err := readMessageIdMark(state.mark); err == nil && markHour == hour {
+			state.index, state.reserved = reserved, reserved
+		}
+		p.extend(state, state.index+1)
+	}
+
+	p.ids.Store(state)
+	logger.Info("MessageId prefix has changed to: %s", state.prefix)
+	return state
+}
+
+// reserve waits for index to be persisted, extending the reservation if need be.
+func (p *catMessageManager) reserve(state *messageIdState, index uint32) {
+	p.idsMu.Lock()
+	defer p.idsMu.Unlock()
+
+	p.extend(state, index)
+}
+
+func (p *catMessageManager) extend(state *messageIdState, index uint32) {
+	reserved := atomic.LoadUint32(&state.reserved)
+	if index <= reserved {
+		return
+	}
+	for reserved < index {
+		reserved += messageIdReserveStep
+	}
+	if err := writeMessageIdMark(state.mark, state.hour, reserved); err != nil {
+		logger.Warning("Cannot persist message id index: %s", err)
+	}
+	atomic.StoreUint32(&state.reserved, reserved)
+}
+
+// persistIds makes the indexes of message ids persisted in a mark file under dir,
+// so that a restarted process doesn't issue the ids it did before within the same hour.
+func (p *catMessageManager) persistIds(dir, domain string) {
+	p.idsMu.Lock()
+	defer p.idsMu.Unlock()
+
+	p.mark = filepath.Join(dir, "cat-"+domain+".mark")
+	p.ids.Store((*messageIdState)(nil))
+}
+
+func readMessageIdMark(path string) (hour int, index uint32, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var i uint64
+	if _, err = fmt.Sscanf(string(data), "%d %d", &hour, &i); err != nil {
+		return
+	}
+	return hour, uint32(i), nil
+}
+
+// writeMessageIdMark replaces the mark file at once, so that it is never read half written.
+func writeMessageIdMark(path string, hour int, index uint32) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(fmt.Sprintf("%d %d\n", hour, index)), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,89 @@
+package cat
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func issueIds(m *catMessageManager, hours []int, count int) []string {
+	var (
+		wg  sync.WaitGroup
+		ids = make([][]string, len(hours))
+	)
+	for i, hour := range hours {
+		wg.Add(1)
+		go func(i, hour int) {
+			defer wg.Done()
+			for j := 0; j < count; j++ {
+				ids[i] = append(ids[i], m.nextId(hour))
+			}
+		}(i, hour)
+	}
+	wg.Wait()
+
+	var all []string
+	for _, x := range ids {
+		all = append(all, x...)
+	}
+	return all
+}
+
+func assertUnique(t *testing.T, ids []string) {
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			t.Fatalf("message id %s has been issued twice", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestNextIdConcurrent(t *testing.T) {
+	m := &catMessageManager{}
+	ids := issueIds(m, []int{1, 1, 1, 1, 1, 1, 1, 1}, 1000)
+	assertUnique(t, ids)
+
+	if id := m.NextId(); !strings.HasPrefix(id, config.domain+"-"+config.ipHex+"-") {
+		t.Errorf("unexpected message id: %s", id)
+	}
+}
+
+func TestNextIdRollover(t *testing.T) {
+	m := &catMessageManager{}
+	ids := issueIds(m, []int{1, 2, 1, 2, 1, 2}, 1000)
+	assertUnique(t, ids)
+
+	// an hour over is not started again.
+	if id := m.nextId(1); !strings.Contains(id, "-2-") {
+		t.Errorf("the message id should be of the latest hour: %s", id)
+	}
+}
+
+func TestNextIdPersisted(t *testing.T) {
+	dir := t.TempDir()
+
+	m := &catMessageManager{}
+	m.persistIds(dir, "test")
+	ids := issueIds(m, []int{1, 1, 1, 1}, messageIdReserveStep/2)
+
+	// restarted within the hour.
+	restarted := &catMessageManager{}
+	restarted.persistIds(dir, "test")
+	ids = append(ids, issueIds(restarted, []int{1, 1}, 10)...)
+	assertUnique(t, ids)
+
+	id := restarted.nextId(1)
+	index, _ := strconv.Atoi(id[strings.LastIndex(id, "-")+1:])
+	if index <= 2*messageIdReserveStep {
+		t.Errorf("the index should resume after the reserved ones: %s", id)
+	}
+
+	// restarted the next hour.
+	next := &catMessageManager{}
+	next.persistIds(dir, "test")
+	if id := next.nextId(2); !strings.HasSuffix(id, "-2-1") {
+		t.Errorf("the index should start over: %s", id)
+	}
+}
@@ -2,9 +2,9 @@ package cat
 
 import (
 	"bytes"
-	"encoding/xml"
 	"runtime"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/shirou/gopsutil/cpu"
@@ -15,35 +15,123 @@ import (
 
 type catMonitor struct {
 	scheduleMixin
-	collectors []Collector
+	collectors *collectorRegistry
+
+	// heartbeats are sent at every multiple of interval, a collection taking longer than timeout is skipped.
+	interval time.Duration
+	timeout  time.Duration
+
+	timer *time.Timer
+	next  time.Time
+	// collecting receives the status of the collection running, if any.
+	collecting chan collectedStatus
+
+	skipped, timeouts uint64
+}
+
+type collectedStatus struct {
+	start time.Time
+	data  *bytes.Buffer
 }
 
 func (m *catMonitor) GetName() string {
 	return "Monitor"
 }
 
-func sleep2NextMinute() *time.Timer {
-	var delta = 60 - time.Now().Second()
-	return time.NewTimer(time.Duration(delta) * time.Second)
+func (m *catMonitor) configure(interval, timeout time.Duration) {
+	if interval <= 0 {
+		interval = defaultHeartbeatInterval
+	}
+	if timeout <= 0 {
+		timeout = defaultHeartbeatTimeout
+	}
+	if timeout > interval {
+		timeout = interval
+	}
+	m.interval, m.timeout = interval, timeout
 }
 
 func (m *catMonitor) afterStart() {
 	LogEvent(typeSystem, nameReboot)
-	m.collectAndSend()
+
+	m.timer = time.NewTimer(m.interval)
+	m.reschedule(time.Now())
+	m.heartbeat()
 }
 
-func (m *catMonitor) process() {
-	timer := sleep2NextMinute()
-	defer timer.Stop()
+func (m *catMonitor) beforeStop() {
+	m.timer.Stop()
+}
 
+func (m *catMonitor) process() {
 	select {
 	case sig := <-m.signals:
 		m.handle(sig)
-	case <-timer.C:
-		m.collectAndSend()
+	case now := <-m.timer.C:
+		m.reschedule(now)
+		m.heartbeat()
+	}
+}
+
+// reschedule sets the timer to the next multiple of the interval. The heartbeats of the intervals which have
+// passed entirely since the scheduled one, while a collection was running or the process was suspended,
+// are skipped rather than sent at once.
+func (m *catMonitor) reschedule(now time.Time) {
+	if !m.next.IsZero() {
+		if missed := now.Sub(m.next) / m.interval; missed > 0 {
+			atomic.AddUint64(&m.skipped, uint64(missed))
+			logger.Warning("%d heartbeats have been skipped.", missed)
+		}
+	}
+
+	m.next = now.Truncate(m.interval).Add(m.interval)
+	m.timer.Reset(m.next.Sub(now))
+}
+
+// heartbeat sends the status collected within the timeout, while still handling signals.
+// A collection timed out keeps running and is waited for by the next heartbeat, rather than started again,
+// but the status it collects is outdated then: it is discarded, and a new collection is started.
+func (m *catMonitor) heartbeat() {
+	// the collections started before the current interval are outdated.
+	current := m.next.Add(-m.interval)
+
+	timer := time.NewTimer(m.timeout)
+	defer timer.Stop()
+
+	for {
+		if m.collecting == nil {
+			m.collect()
+		}
+
+		select {
+		case sig := <-m.signals:
+			m.handle(sig)
+			return
+		case status := <-m.collecting:
+			m.collecting = nil
+			if status.start.Before(current) {
+				continue
+			}
+			m.send(status)
+			return
+		case <-timer.C:
+			atomic.AddUint64(&m.timeouts, 1)
+			logger.Warning("Heartbeat collection has timed out after %s.", m.timeout)
+			return
+		}
 	}
 }
 
+// collect starts collecting the status in a goroutine, which m.collecting receives it from.
+func (m *catMonitor) collect() {
+	ch := make(chan collectedStatus, 1)
+	go func() {
+		start := time.Now()
+		ch <- collectedStatus{start: start, data: m.buildXml()}
+	}()
+	m.collecting = ch
+}
+
 type OSInfo struct {
 	Name                string `xml:"name,attr"`
 	Arch                string `xml:"arch,attr"`
@@ -59,34 +147,15 @@ type OSInfo struct {
 }
 
 func (m *catMonitor) buildXml() *bytes.Buffer {
-	type ExtensionDetail struct {
-		Id    string `xml:"id,attr"`
-		Value string `xml:"value,attr"`
-	}
-
-	type Extension struct {
-		Id      string            `xml:"id,attr"`
-		Desc    string            `xml:"description"`
-		Details []ExtensionDetail `xml:"extensionDetail"`
-	}
-
-	type CustomInfo struct {
-		Key   string `xml:"key,attr"`
-		Value string `xml:"value,attr"`
-	}
-
-	type Status struct {
-		XMLName     xml.Name     `xml:"status"`
-		Timestamp   string       `xml:"timestamp,attr"`
-		OS          OSInfo       `xml:"os"`
-		Extensions  []Extension  `xml:"extension"`
-		CustomInfos []CustomInfo `xml:"customInfo"`
-	}
-
-	status := Status{
-		Timestamp:   time.Now().Format("2006-01-02 15:04:05.999"),
-		Extensions:  make([]Extension, 0, len(m.collectors)),
-		CustomInfos: make([]CustomInfo, 0, 3),
+	now := time.Now()
+	status := statusInfo{
+		Timestamp:   now.Format("2006-01-02 15:04:05.999"),
+		Runtime:     collectRuntime(now),
+		Disk:        collectDisk(),
+		Memory:      collectMemory(),
+		Thread:      collectThread(),
+		Extensions:  make([]extension, 0, m.collectors.len()),
+		CustomInfos: make([]customInfo, 0, 3),
 		OS:          OSInfo{},
 	}
 
@@ -102,50 +171,53 @@ func (m *catMonitor) buildXml() *bytes.Buffer {
 		status.OS.AvailableProcessors = strconv.Itoa(runtime.GOMAXPROCS(0))
 	}
 
-	for _, collector := range m.collectors {
-		extension := Extension{
-			Id:      collector.GetId(),
-			Desc:    collector.GetDesc(),
-			Details: make([]ExtensionDetail, 0),
-		}
+	for _, result := range m.collectors.collect() {
+		if result.properties != nil {
+			ext := extension{
+				Id:      result.id,
+				Desc:    result.desc,
+				Details: make([]extensionDetail, 0, len(result.properties)),
+			}
 
-		for k, v := range collector.GetProperties() {
-			detail := ExtensionDetail{
-				Id:    k,
-				Value: v,
+			for k, v := range result.properties {
+				detail := extensionDetail{
+					Id:    k,
+					Value: v,
+				}
+				ext.Details = append(ext.Details, detail)
 			}
-			extension.Details = append(extension.Details, detail)
+			status.Extensions = append(status.Extensions, ext)
 		}
-		status.Extensions = append(status.Extensions, extension)
 
-		collector.Fetch(&status.OS)
+		if result.err != nil {
+			logger.Warning("Error occurred while collecting %s: %s", result.id, result.err)
+			status.CustomInfos = append(status.CustomInfos, customInfo{"collector-error." + result.id, result.err.Error()})
+			continue
+		}
+		status.OS.merge(&result.os)
 	}
 
 	// add custom information.
-	status.CustomInfos = append(status.CustomInfos, CustomInfo{"gocat-version", GoCatVersion})
-	status.CustomInfos = append(status.CustomInfos, CustomInfo{"go-version", runtime.Version()})
-
-	buf := bytes.NewBuffer([]byte{})
-	encoder := xml.NewEncoder(buf)
-	//encoder.Indent("", "\t")
-
-	if err := encoder.Encode(status); err != nil {
-		buf.Reset()
-		buf.WriteString(err.Error())
-		return buf
+	status.CustomInfos = append(status.CustomInfos, customInfo{"gocat-version", GoCatVersion})
+	status.CustomInfos = append(status.CustomInfos, customInfo{"go-version", runtime.Version()})
+	for _, transition := range routerTransitions {
+		count := strconv.FormatUint(router.stats.get(transition), 10)
+		status.CustomInfos = append(status.CustomInfos, customInfo{"router." + transition, count})
 	}
-	return buf
+	status.CustomInfos = append(status.CustomInfos, customInfo{"heartbeat.skipped", strconv.FormatUint(atomic.LoadUint64(&m.skipped), 10)})
+	status.CustomInfos = append(status.CustomInfos, customInfo{"heartbeat.timeouts", strconv.FormatUint(atomic.LoadUint64(&m.timeouts), 10)})
+
+	return encodeStatus(&status)
 }
 
-func (m *catMonitor) collectAndSend() {
+func (m *catMonitor) send(status collectedStatus) {
 	var trans = message.NewTransaction(typeSystem, "Status", Manager.flush)
+	trans.SetDurationStart(status.start)
 	defer trans.Complete()
 
-	//trans.LogEvent("Cat_golang_Client_Version", GoCatVersion)
-
 	// NOTE type & name is useless while sending a heartbeat
 	heartbeat := message.NewHeartbeat("Heartbeat", config.ip, nil)
-	heartbeat.SetData(m.buildXml().String())
+	heartbeat.SetData(status.data.String())
 	heartbeat.Complete()
 
 	trans.AddChild(heartbeat)
@@ -153,16 +225,33 @@ func (m *catMonitor) collectAndSend() {
 
 var monitor = catMonitor{
 	scheduleMixin: makeScheduleMixedIn(signalMonitorExit),
-	collectors: []Collector{
+	collectors: newCollectorRegistry(
 		/*&memStatsCollector{},
 		&cpuInfoCollector{
 			lastTime:    &cpu.TimesStat{},
 			lastCPUTime: 0,
 		},*/
 		&systemCollector{},
-	},
+	),
+	interval: defaultHeartbeatInterval,
+	timeout:  defaultHeartbeatTimeout,
 }
 
+// AddMonitorCollector registers a collector whose properties are reported with every heartbeat.
+// It is safe to be called at any time, nil collectors are ignored.
 func AddMonitorCollector(collector Collector) {
-	monitor.collectors = append(monitor.collectors, collector)
+	AddMonitorCollectorWithTimeout(collector, defaultCollectorTimeout)
+}
+
+// AddMonitorCollectorWithTimeout is like AddMonitorCollector, but a collection taking longer than timeout is
+// abandoned and reported as an error in the heartbeat instead of delaying it.
+func AddMonitorCollectorWithTimeout(collector Collector, timeout time.Duration) {
+	if err := monitor.collectors.add(collector, timeout); err != nil {
+		logger.Warning("Cannot add monitor collector: %s", err)
+	}
+}
+
+// RemoveMonitorCollector unregisters a collector, it returns false if the collector has not been registered.
+func RemoveMonitorCollector(collector Collector) bool {
+	return monitor.collectors.remove(collector)
 }
@@ -0,0 +1,194 @@
+package cat
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type collectorEntry struct {
+	collector Collector
+	id        string
+	timeout   time.Duration
+	running   uint32
+}
+
+type collectorResult struct {
+	id         string
+	desc       string
+	properties map[string]string
+	os         OSInfo
+	err        error
+}
+
+type collectorRegistry struct {
+	mu      sync.RWMutex
+	entries []*collectorEntry
+}
+
+func newCollectorRegistry(collectors ...Collector) *collectorRegistry {
+	r := &collectorRegistry{
+		entries: make([]*collectorEntry, 0, len(collectors)),
+	}
+	for _, collector := range collectors {
+		r.add(collector, defaultCollectorTimeout)
+	}
+	return r
+}
+
+func safeCollectorId(collector Collector) (id string, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("Collector panicked while getting id: %v", e)
+		}
+	}()
+	return collector.GetId(), nil
+}
+
+func (r *collectorRegistry) add(collector Collector, timeout time.Duration) error {
+	if collector == nil {
+		return errors.New("Collector should not be nil")
+	}
+	if timeout <= 0 {
+		timeout = defaultCollectorTimeout
+	}
+
+	id, err := safeCollectorId(collector)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, entry := range r.entries {
+		if entry.collector == collector {
+			entry.timeout = timeout
+			return nil
+		}
+	}
+	r.entries = append(r.entries, &collectorEntry{
+		collector: collector,
+		id:        id,
+		timeout:   timeout,
+	})
+	return nil
+}
+
+func (r *collectorRegistry) remove(collector Collector) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, entry := range r.entries {
+		if entry.collector == collector {
+			r.entries = append(r.entries[:i:i], r.entries[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (r *collectorRegistry) snapshot() []*collectorEntry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries := make([]*collectorEntry, len(r.entries))
+	copy(entries, r.entries)
+	return entries
+}
+
+func (r *collectorRegistry) len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.entries)
+}
+
+// collect runs every registered collector concurrently and waits for each of them at most its own timeout
+// from the start of the collection, so that it never waits longer than the largest timeout.
+// Results are returned in registration order, a collector which panicked, failed or timed out carries a non-nil err.
+func (r *collectorRegistry) collect() []collectorResult {
+	entries := r.snapshot()
+
+	start := time.Now()
+	chs := make([]chan collectorResult, len(entries))
+	deadlines := make([]time.Time, len(entries))
+	for i, entry := range entries {
+		chs[i] = entry.run()
+		deadlines[i] = start.Add(entry.timeout)
+	}
+
+	results := make([]collectorResult, len(entries))
+	for i, entry := range entries {
+		if chs[i] == nil {
+			results[i] = collectorResult{
+				id:  entry.id,
+				err: errors.New("Previous collection is still running"),
+			}
+			continue
+		}
+
+		timer := time.NewTimer(time.Until(deadlines[i]))
+		select {
+		case results[i] = <-chs[i]:
+		case <-timer.C:
+			// the deadline may have passed while waiting for the previous collectors, a result is still taken if any.
+			select {
+			case results[i] = <-chs[i]:
+			default:
+				results[i] = collectorResult{
+					id:  entry.id,
+					err: fmt.Errorf("Collection timed out after %s", entry.timeout),
+				}
+			}
+		}
+		timer.Stop()
+	}
+	return results
+}
+
+// run starts a collection in its own goroutine, it returns nil if the last collection has not finished yet,
+// so that a stuck collector is never executed concurrently with itself.
+func (e *collectorEntry) run() chan collectorResult {
+	if !atomic.CompareAndSwapUint32(&e.running, 0, 1) {
+		return nil
+	}
+
+	ch := make(chan collectorResult, 1)
+	go func() {
+		var result = collectorResult{id: e.id}
+
+		defer func() {
+			if err := recover(); err != nil {
+				result.err = fmt.Errorf("Collector panicked: %v", err)
+			}
+			atomic.StoreUint32(&e.running, 0)
+			ch <- result
+		}()
+
+		result.desc = e.collector.GetDesc()
+		result.properties = e.collector.GetProperties()
+		result.err = e.collector.Fetch(&result.os)
+	}()
+	return ch
+}
+
+func (info *OSInfo) merge(other *OSInfo) {
+	mergeString := func(dst *string, src string) {
+		if src != "" {
+			*dst = src
+		}
+	}
+
+	mergeString(&info.Name, other.Name)
+	mergeString(&info.Arch, other.Arch)
+	mergeString(&info.Version, other.Version)
+	mergeString(&info.AvailableProcessors, other.AvailableProcessors)
+	mergeString(&info.SystemLoadAverage, other.SystemLoadAverage)
+	mergeString(&info.TotalPhysicalMemory, other.TotalPhysicalMemory)
+	mergeString(&info.FreePhysicalMemory, other.FreePhysicalMemory)
+	mergeString(&info.CommittedVirtualMemory, other.CommittedVirtualMemory)
+	mergeString(&info.TotalSwapSpace, other.TotalSwapSpace)
+	mergeString(&info.FreeSwapSpace, other.FreeSwapSpace)
+}
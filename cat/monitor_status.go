@@ -0,0 +1,181 @@
+package cat
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"os/user"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/shirou/gopsutil/disk"
+)
+
+// The heartbeat status, mirroring the sections the Java client reports, filled with their go equivalents.
+
+type runtimeInfo struct {
+	StartTime string `xml:"start-time,attr"`
+	UpTime    string `xml:"up-time,attr"`
+	Version   string `xml:"java-version,attr"`
+	UserName  string `xml:"user-name,attr"`
+	UserDir   string `xml:"user-dir"`
+}
+
+type diskVolume struct {
+	Id     string `xml:"id,attr"`
+	Total  string `xml:"total,attr"`
+	Free   string `xml:"free,attr"`
+	Usable string `xml:"usable,attr"`
+}
+
+type diskInfo struct {
+	Volumes []diskVolume `xml:"disk-volume"`
+}
+
+type gcInfo struct {
+	Name  string `xml:"name,attr"`
+	Count string `xml:"count,attr"`
+	Time  string `xml:"time,attr"`
+}
+
+type memoryInfo struct {
+	Max          string   `xml:"max,attr"`
+	Total        string   `xml:"total,attr"`
+	Free         string   `xml:"free,attr"`
+	HeapUsage    string   `xml:"heap-usage,attr"`
+	NonHeapUsage string   `xml:"non-heap-usage,attr"`
+	GCs          []gcInfo `xml:"gc"`
+}
+
+type threadInfo struct {
+	Count             string `xml:"count,attr"`
+	DaemonCount       string `xml:"daemon-count,attr"`
+	PeekCount         string `xml:"peek-count,attr"`
+	TotalStartedCount string `xml:"total-started-count,attr"`
+	CatThreadCount    string `xml:"cat-thread-count,attr"`
+}
+
+type extensionDetail struct {
+	Id    string `xml:"id,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type extension struct {
+	Id      string            `xml:"id,attr"`
+	Desc    string            `xml:"description"`
+	Details []extensionDetail `xml:"extensionDetail"`
+}
+
+type customInfo struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type statusInfo struct {
+	XMLName     xml.Name     `xml:"status"`
+	Timestamp   string       `xml:"timestamp,attr"`
+	Runtime     runtimeInfo  `xml:"runtime"`
+	OS          OSInfo       `xml:"os"`
+	Disk        diskInfo     `xml:"disk"`
+	Memory      memoryInfo   `xml:"memory"`
+	Thread      threadInfo   `xml:"thread"`
+	Extensions  []extension  `xml:"extension"`
+	CustomInfos []customInfo `xml:"customInfo"`
+}
+
+var (
+	startTime = time.Now()
+	// peakGoroutines is the highest count of goroutines seen by the heartbeats.
+	peakGoroutines int64
+)
+
+func collectRuntime(now time.Time) runtimeInfo {
+	info := runtimeInfo{
+		StartTime: strconv.FormatInt(startTime.UnixNano()/int64(time.Millisecond), 10),
+		UpTime:    strconv.FormatInt(duration2Millis(now.Sub(startTime)), 10),
+		Version:   runtime.Version(),
+	}
+	if u, err := user.Current(); err == nil {
+		info.UserName = u.Username
+	}
+	if dir, err := os.Getwd(); err == nil {
+		info.UserDir = dir
+	}
+	return info
+}
+
+// collectDisk reports the usage of the physical partitions, free counting the space reserved to root,
+// usable not.
+func collectDisk() diskInfo {
+	var info diskInfo
+
+	partitions, err := disk.Partitions(false)
+	if err != nil {
+		return info
+	}
+	for _, partition := range partitions {
+		usage, err := disk.Usage(partition.Mountpoint)
+		if err != nil || usage.Total == 0 {
+			continue
+		}
+		info.Volumes = append(info.Volumes, diskVolume{
+			Id:     partition.Mountpoint,
+			Total:  strconv.FormatUint(usage.Total, 10),
+			Free:   strconv.FormatUint(usage.Total-usage.Used, 10),
+			Usable: strconv.FormatUint(usage.Free, 10),
+		})
+	}
+	return info
+}
+
+// collectMemory reports the memory obtained from the system as the total, the heap as the max,
+// and its idle part not returned to the system as free. The gc count and pause time are cumulative.
+func collectMemory() memoryInfo {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	return memoryInfo{
+		Max:          strconv.FormatUint(m.HeapSys, 10),
+		Total:        strconv.FormatUint(m.Sys, 10),
+		Free:         strconv.FormatUint(m.HeapIdle-m.HeapReleased, 10),
+		HeapUsage:    strconv.FormatUint(m.HeapAlloc, 10),
+		NonHeapUsage: strconv.FormatUint(m.Sys-m.HeapSys, 10),
+		GCs: []gcInfo{{
+			Name:  "go",
+			Count: strconv.FormatUint(uint64(m.NumGC), 10),
+			Time:  strconv.FormatUint(m.PauseTotalNs/uint64(time.Millisecond), 10),
+		}},
+	}
+}
+
+// collectThread reports goroutines as threads, there are no daemon ones.
+func collectThread() threadInfo {
+	count := int64(runtime.NumGoroutine())
+	for {
+		peak := atomic.LoadInt64(&peakGoroutines)
+		if count <= peak || atomic.CompareAndSwapInt64(&peakGoroutines, peak, count) {
+			break
+		}
+	}
+
+	return threadInfo{
+		Count:             strconv.FormatInt(count, 10),
+		DaemonCount:       "0",
+		PeekCount:         strconv.FormatInt(atomic.LoadInt64(&peakGoroutines), 10),
+		TotalStartedCount: "0",
+		CatThreadCount:    "0",
+	}
+}
+
+func encodeStatus(s *statusInfo) *bytes.Buffer {
+	buf := bytes.NewBuffer([]byte{})
+	encoder := xml.NewEncoder(buf)
+
+	if err := encoder.Encode(s); err != nil {
+		buf.Reset()
+		buf.WriteString(err.Error())
+	}
+	return buf
+}
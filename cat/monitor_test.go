@@ -1,9 +1,311 @@
 package cat
 
 import (
+	"encoding/xml"
+	"errors"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/xiaobudongzhang/cat-go/message"
 )
 
+type testCollector struct {
+	id    string
+	sleep time.Duration
+	panic bool
+	err   error
+}
+
+func (c *testCollector) GetId() string {
+	return c.id
+}
+
+func (c *testCollector) GetDesc() string {
+	return c.id
+}
+
+func (c *testCollector) GetProperties() map[string]string {
+	if c.panic {
+		panic("boom")
+	}
+	time.Sleep(c.sleep)
+	return map[string]string{"k": "v"}
+}
+
+func (c *testCollector) Fetch(os *OSInfo) error {
+	os.Name = c.id
+	return c.err
+}
+
 func TestAddMonitorCollector(t *testing.T) {
+	n := monitor.collectors.len()
 	AddMonitorCollector(nil)
+	if monitor.collectors.len() != n {
+		t.Fatal("nil collector should not be registered")
+	}
+
+	c := &testCollector{id: "test"}
+	AddMonitorCollector(c)
+	AddMonitorCollector(c)
+	if monitor.collectors.len() != n+1 {
+		t.Fatalf("expected %d collectors, got %d", n+1, monitor.collectors.len())
+	}
+	if !RemoveMonitorCollector(c) || RemoveMonitorCollector(c) {
+		t.Fatal("collector should be removed exactly once")
+	}
+}
+
+func TestCollectorRegistryIsolation(t *testing.T) {
+	r := newCollectorRegistry()
+	_ = r.add(&testCollector{id: "ok"}, time.Second)
+	_ = r.add(&testCollector{id: "panic", panic: true}, time.Second)
+	_ = r.add(&testCollector{id: "slow", sleep: time.Second}, 10*time.Millisecond)
+	_ = r.add(&testCollector{id: "error", err: errors.New("failed")}, time.Second)
+
+	results := r.collect()
+	if len(results) != 4 {
+		t.Fatalf("expected 4 results, got %d", len(results))
+	}
+	if results[0].err != nil || results[0].os.Name != "ok" || results[0].properties["k"] != "v" {
+		t.Errorf("unexpected result of ok collector: %+v", results[0])
+	}
+	for _, result := range results[1:] {
+		if result.err == nil {
+			t.Errorf("collector %s should have reported an error", result.id)
+		}
+	}
+	if results[3].properties == nil {
+		t.Error("properties should be kept when Fetch fails")
+	}
+
+	// the slow collector is still running, it must not be started twice.
+	results = r.collect()
+	if results[2].err == nil {
+		t.Error("a running collector should be skipped")
+	}
+}
+
+func TestCollectorRegistryDeadlines(t *testing.T) {
+	r := newCollectorRegistry()
+	_ = r.add(&testCollector{id: "hung-1", sleep: time.Second}, 100*time.Millisecond)
+	_ = r.add(&testCollector{id: "hung-2", sleep: time.Second}, 100*time.Millisecond)
+	_ = r.add(&testCollector{id: "ok"}, 100*time.Millisecond)
+
+	start := time.Now()
+	results := r.collect()
+	if elapsed := time.Since(start); elapsed >= 200*time.Millisecond {
+		t.Errorf("collection took %s, the hung collectors should be waited for at once", elapsed)
+	}
+	if results[0].err == nil || results[1].err == nil {
+		t.Error("hung collectors should have timed out")
+	}
+	if results[2].err != nil || results[2].os.Name != "ok" {
+		t.Errorf("unexpected result of ok collector: %+v", results[2])
+	}
+}
+
+func TestStatusXml(t *testing.T) {
+	status := statusInfo{
+		Timestamp: "2024-01-02 03:04:05.678",
+		Runtime: runtimeInfo{
+			StartTime: "1704164645678",
+			UpTime:    "60000",
+			Version:   "go1.21.0",
+			UserName:  "app",
+			UserDir:   "/opt/app",
+		},
+		OS: OSInfo{
+			Name:                   "ubuntu",
+			Arch:                   "amd64",
+			Version:                "22.04",
+			AvailableProcessors:    "8",
+			SystemLoadAverage:      "0.500000",
+			TotalPhysicalMemory:    "16777216",
+			FreePhysicalMemory:     "8388608",
+			CommittedVirtualMemory: "4194304",
+			TotalSwapSpace:         "2097152",
+			FreeSwapSpace:          "1048576",
+		},
+		Disk: diskInfo{Volumes: []diskVolume{
+			{Id: "/", Total: "1000", Free: "400", Usable: "300"},
+			{Id: "/data", Total: "2000", Free: "1500", Usable: "1400"},
+		}},
+		Memory: memoryInfo{
+			Max:          "4096",
+			Total:        "8192",
+			Free:         "1024",
+			HeapUsage:    "2048",
+			NonHeapUsage: "4096",
+			GCs:          []gcInfo{{Name: "go", Count: "12", Time: "3"}},
+		},
+		Thread: threadInfo{
+			Count:             "42",
+			DaemonCount:       "0",
+			PeekCount:         "64",
+			TotalStartedCount: "0",
+			CatThreadCount:    "0",
+		},
+		Extensions: []extension{{
+			Id:      "System",
+			Desc:    "System",
+			Details: []extensionDetail{{Id: "LoadAverage", Value: "0.500000"}},
+		}},
+		CustomInfos: []customInfo{{Key: "gocat-version", Value: "2.0.0"}},
+	}
+
+	golden, err := os.ReadFile("testdata/status.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the golden file is indented for readability, the heartbeat is not.
+	var expected strings.Builder
+	for _, line := range strings.Split(string(golden), "\n") {
+		expected.WriteString(strings.TrimSpace(line))
+	}
+
+	if actual := encodeStatus(&status).String(); actual != expected.String() {
+		t.Errorf("unexpected status:\n%s\nexpected:\n%s", actual, expected.String())
+	}
+}
+
+func TestBuildXml(t *testing.T) {
+	var status statusInfo
+	if err := xml.Unmarshal(monitor.buildXml().Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+
+	if status.Runtime.StartTime == "" || status.Runtime.Version != runtime.Version() || status.Runtime.UserDir == "" {
+		t.Errorf("the runtime section should be filled: %+v", status.Runtime)
+	}
+	if status.Memory.Total == "0" || len(status.Memory.GCs) != 1 {
+		t.Errorf("the memory section should be filled: %+v", status.Memory)
+	}
+	count, _ := strconv.Atoi(status.Thread.Count)
+	peak, _ := strconv.Atoi(status.Thread.PeekCount)
+	if count == 0 || peak < count {
+		t.Errorf("the thread section should count goroutines: %+v", status.Thread)
+	}
+}
+
+func newTestMonitor(interval, timeout time.Duration, collectors ...Collector) *catMonitor {
+	m := &catMonitor{
+		scheduleMixin: makeScheduleMixedIn(signalMonitorExit),
+		collectors:    newCollectorRegistry(),
+		timer:         time.NewTimer(time.Hour),
+	}
+	for _, collector := range collectors {
+		_ = m.collectors.add(collector, time.Minute)
+	}
+	m.configure(interval, timeout)
+	m.setAlive(true)
+	return m
+}
+
+func TestMonitorConfigure(t *testing.T) {
+	m := newTestMonitor(0, 0)
+	if m.interval != defaultHeartbeatInterval || m.timeout != defaultHeartbeatTimeout {
+		t.Errorf("unexpected defaults: %s %s", m.interval, m.timeout)
+	}
+	m.configure(10*time.Second, 0)
+	if m.timeout != 10*time.Second {
+		t.Errorf("the timeout should not exceed the interval: %s", m.timeout)
+	}
+}
+
+func TestMonitorReschedule(t *testing.T) {
+	m := newTestMonitor(time.Minute, time.Second)
+	defer m.timer.Stop()
+
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	m.reschedule(start)
+	if expected := time.Date(2024, 1, 2, 3, 5, 0, 0, time.UTC); !m.next.Equal(expected) {
+		t.Fatalf("the heartbeat should be aligned on the minute: %s", m.next)
+	}
+
+	// fired a bit late, sent anyway.
+	m.reschedule(m.next.Add(500 * time.Millisecond))
+	if m.skipped != 0 || m.next.Minute() != 6 {
+		t.Errorf("a late heartbeat should not be skipped: %d, %s", m.skipped, m.next)
+	}
+
+	// suspended for minutes.
+	m.reschedule(m.next.Add(2*time.Minute + 10*time.Second))
+	if m.skipped != 2 || m.next.Minute() != 9 {
+		t.Errorf("the heartbeats of the missed minutes should be skipped: %d, %s", m.skipped, m.next)
+	}
+}
+
+func TestMonitorHeartbeatTimeout(t *testing.T) {
+	m := newTestMonitor(time.Minute, 20*time.Millisecond, &testCollector{id: "slow", sleep: 200 * time.Millisecond})
+	defer m.timer.Stop()
+
+	start := time.Now()
+	m.heartbeat()
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("the heartbeat should not wait for a slow collection: %s", elapsed)
+	}
+	if m.timeouts != 1 || m.collecting == nil {
+		t.Fatalf("the collection should have timed out and still be running: %d", m.timeouts)
+	}
+
+	// the running collection is waited for, not started again.
+	m.configure(time.Minute, time.Second)
+	m.heartbeat()
+	if m.timeouts != 1 || m.collecting != nil {
+		t.Errorf("the running collection should have been sent: %d", m.timeouts)
+	}
+}
+
+func TestMonitorHeartbeatOutdated(t *testing.T) {
+	m := newTestMonitor(time.Minute, 20*time.Millisecond, &testCollector{id: "slow", sleep: 100 * time.Millisecond})
+	defer m.timer.Stop()
+
+	sent := make(chan time.Time, 2)
+	defer AddFlushHook(func(msg message.Messager) {
+		if trans, ok := msg.(*message.Transaction); ok && trans.GetType() == typeSystem && trans.GetName() == "Status" {
+			sent <- trans.GetTime()
+		}
+	})()
+
+	m.reschedule(time.Now())
+	m.heartbeat()
+	if m.timeouts != 1 || m.collecting == nil {
+		t.Fatalf("the collection should have timed out and still be running: %d", m.timeouts)
+	}
+
+	// the next interval has started, the running collection is outdated.
+	m.next = time.Now().Add(m.interval)
+	m.configure(time.Minute, time.Second)
+	m.heartbeat()
+
+	select {
+	case start := <-sent:
+		if current := m.next.Add(-m.interval); start.Before(current) {
+			t.Errorf("an outdated status has been sent: %s before %s", start, current)
+		}
+	default:
+		t.Fatal("a new status should have been collected and sent")
+	}
+	if len(sent) != 0 {
+		t.Error("a single status should have been sent")
+	}
+}
+
+func TestMonitorHeartbeatShutdown(t *testing.T) {
+	m := newTestMonitor(time.Minute, time.Minute, &testCollector{id: "slow", sleep: time.Second})
+	defer m.timer.Stop()
+
+	go func() {
+		m.signals <- signalShutdown
+	}()
+
+	start := time.Now()
+	m.heartbeat()
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond || m.alive() {
+		t.Errorf("a shutdown should not wait for the collection: %s", elapsed)
+	}
 }
@@ -0,0 +1,37 @@
+package cat
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/xiaobudongzhang/cat-go/message"
+)
+
+// maxPooledBufferSize bounds the buffers given back to bufferPool, so that a huge tree doesn't stay held.
+const maxPooledBufferSize = 64 * 1024
+
+// bufferPool holds the buffers messages are encoded in, given back once the frames have been sent.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf == nil || buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+// releaseMessage gives m back to its pool once it has been handled, if it has been taken from one.
+func releaseMessage(m message.Messager) {
+	if e, ok := m.(*message.Event); ok {
+		e.Release()
+	}
+}
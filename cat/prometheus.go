@@ -0,0 +1,279 @@
+package cat
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xiaobudongzhang/cat-go/message"
+)
+
+type promTransaction struct {
+	count, fail int64
+	sum         int64
+	buckets     []int64
+}
+
+type promEvent struct {
+	count, fail int64
+}
+
+type promMetric struct {
+	count    int64
+	duration time.Duration
+	timed    bool
+}
+
+// promExporter accumulates the windows drained by the aggregators,
+// the transactions and events being observed into them from the caller's goroutine.
+type promExporter struct {
+	enabled uint32
+
+	mu           sync.Mutex
+	transactions map[aggregatorKey]*promTransaction
+	events       map[aggregatorKey]*promEvent
+	metrics      map[string]*promMetric
+}
+
+var exporter = promExporter{
+	transactions: make(map[aggregatorKey]*promTransaction),
+	events:       make(map[aggregatorKey]*promEvent),
+	metrics:      make(map[string]*promMetric),
+}
+
+// PrometheusHandler returns a handler exposing the transactions, events and metrics seen by cat,
+// in the prometheus text format. Data is only collected once the handler has been created,
+// and is exposed once the aggregators have drained it, every few seconds.
+func PrometheusHandler() http.Handler {
+	atomic.StoreUint32(&exporter.enabled, 1)
+	return &exporter
+}
+
+func (p *promExporter) isEnabled() bool {
+	return atomic.LoadUint32(&p.enabled) > 0
+}
+
+func (p *promExporter) observe(m message.Messager) {
+	if !p.isEnabled() {
+		return
+	}
+
+	switch m := m.(type) {
+	case *message.Transaction:
+		if m.GetType() != typeSystem {
+			p.observeTransaction(m)
+		}
+	case *message.Event:
+		aggregator.event.observe(m)
+	}
+}
+
+func (p *promExporter) observeTransaction(t *message.Transaction) {
+	aggregator.transaction.observe(t)
+
+	for _, child := range t.GetChildren() {
+		switch child := child.(type) {
+		case *message.Transaction:
+			p.observeTransaction(child)
+		case *message.Event:
+			aggregator.event.observe(child)
+		}
+	}
+}
+
+// promSeries returns the series of key, or of overflow once promMaxSeries series exist,
+// so that unbounded names don't grow the exporter forever.
+func promSeries[K comparable, V any](series map[K]*V, key, overflow K) *V {
+	if data, ok := series[key]; ok {
+		return data
+	}
+	if len(series) >= promMaxSeries {
+		key = overflow
+		if data, ok := series[key]; ok {
+			return data
+		}
+	}
+	data := new(V)
+	series[key] = data
+	return data
+}
+
+func (p *promExporter) addTransactions(dataMap map[aggregatorKey]*transactionData) {
+	if !p.isEnabled() {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, data := range dataMap {
+		if data.observed.count == 0 {
+			continue
+		}
+		series := promSeries(p.transactions, key, aggregatorKey{key.mtype, promOverflowName})
+		if series.buckets == nil {
+			series.buckets = make([]int64, len(durationBoundaries))
+		}
+		series.count += int64(data.observed.count)
+		series.fail += int64(data.observed.fail)
+		series.sum += data.observed.sum
+		for duration, count := range data.observed.durations {
+			// durations beyond the last boundary are only counted by the +Inf bucket.
+			i := sort.Search(len(durationBoundaries), func(i int) bool {
+				return int64(duration) <= durationBoundaries[i]
+			})
+			if i < len(durationBoundaries) {
+				series.buckets[i] += int64(count)
+			}
+		}
+	}
+}
+
+func (p *promExporter) addEvents(dataMap map[aggregatorKey]*eventData) {
+	if !p.isEnabled() {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, data := range dataMap {
+		if data.observed.count == 0 {
+			continue
+		}
+		series := promSeries(p.events, key, aggregatorKey{key.mtype, promOverflowName})
+		series.count += int64(data.observed.count)
+		series.fail += int64(data.observed.fail)
+	}
+}
+
+func (p *promExporter) addMetrics(dataMap map[string]*metricData) {
+	if !p.isEnabled() {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for name, data := range dataMap {
+		series := promSeries(p.metrics, name, promOverflowName)
+		series.count += int64(data.count)
+		series.duration += data.duration
+		series.timed = series.timed || data.duration > 0
+	}
+}
+
+func (p *promExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = w.Write(p.render().Bytes())
+}
+
+func (p *promExporter) render() *bytes.Buffer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	buf := new(bytes.Buffer)
+
+	transactionKeys := sortedAggregatorKeys(p.transactions)
+	buf.WriteString("# HELP cat_transaction_duration_milliseconds Duration of cat transactions.\n")
+	buf.WriteString("# TYPE cat_transaction_duration_milliseconds histogram\n")
+	for _, key := range transactionKeys {
+		data := p.transactions[key]
+		labels := promLabels("type", key.mtype, "name", key.name)
+
+		var cumulative int64
+		for i, boundary := range durationBoundaries {
+			cumulative += data.buckets[i]
+			fmt.Fprintf(buf, "cat_transaction_duration_milliseconds_bucket{%s,le=\"%d\"} %d\n", labels, boundary, cumulative)
+		}
+		fmt.Fprintf(buf, "cat_transaction_duration_milliseconds_bucket{%s,le=\"+Inf\"} %d\n", labels, data.count)
+		fmt.Fprintf(buf, "cat_transaction_duration_milliseconds_sum{%s} %d\n", labels, data.sum)
+		fmt.Fprintf(buf, "cat_transaction_duration_milliseconds_count{%s} %d\n", labels, data.count)
+	}
+
+	buf.WriteString("# HELP cat_transaction_failures_total Count of cat transactions with a non-success status.\n")
+	buf.WriteString("# TYPE cat_transaction_failures_total counter\n")
+	for _, key := range transactionKeys {
+		data := p.transactions[key]
+		fmt.Fprintf(buf, "cat_transaction_failures_total{%s} %d\n", promLabels("type", key.mtype, "name", key.name), data.fail)
+	}
+
+	eventKeys := sortedAggregatorKeys(p.events)
+	buf.WriteString("# HELP cat_event_total Count of cat events.\n")
+	buf.WriteString("# TYPE cat_event_total counter\n")
+	for _, key := range eventKeys {
+		data := p.events[key]
+		fmt.Fprintf(buf, "cat_event_total{%s} %d\n", promLabels("type", key.mtype, "name", key.name), data.count)
+	}
+	buf.WriteString("# HELP cat_event_failures_total Count of cat events with a non-success status.\n")
+	buf.WriteString("# TYPE cat_event_failures_total counter\n")
+	for _, key := range eventKeys {
+		data := p.events[key]
+		fmt.Fprintf(buf, "cat_event_failures_total{%s} %d\n", promLabels("type", key.mtype, "name", key.name), data.fail)
+	}
+
+	metricKeys := sortedKeys(p.metrics)
+	buf.WriteString("# HELP cat_metric_count_total Sum of the counts logged by cat metrics.\n")
+	buf.WriteString("# TYPE cat_metric_count_total counter\n")
+	for _, key := range metricKeys {
+		data := p.metrics[key]
+		if !data.timed {
+			fmt.Fprintf(buf, "cat_metric_count_total{%s} %d\n", promLabels("name", key), data.count)
+		}
+	}
+	buf.WriteString("# HELP cat_metric_duration_milliseconds Durations logged by cat metrics.\n")
+	buf.WriteString("# TYPE cat_metric_duration_milliseconds summary\n")
+	for _, key := range metricKeys {
+		data := p.metrics[key]
+		if data.timed {
+			fmt.Fprintf(buf, "cat_metric_duration_milliseconds_sum{%s} %d\n", promLabels("name", key), duration2Millis(data.duration))
+			fmt.Fprintf(buf, "cat_metric_duration_milliseconds_count{%s} %d\n", promLabels("name", key), data.count)
+		}
+	}
+
+	return buf
+}
+
+var promLabelValueReplacer = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+func promLabels(pairs ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteRune(',')
+		}
+		b.WriteString(pairs[i])
+		b.WriteString("=\"")
+		b.WriteString(promLabelValueReplacer.Replace(pairs[i+1]))
+		b.WriteRune('"')
+	}
+	return b.String()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedAggregatorKeys[V any](m map[aggregatorKey]V) []aggregatorKey {
+	keys := make([]aggregatorKey, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].mtype != keys[j].mtype {
+			return keys[i].mtype < keys[j].mtype
+		}
+		return keys[i].name < keys[j].name
+	})
+	return keys
+}
@@ -0,0 +1,77 @@
+package cat
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xiaobudongzhang/cat-go/message"
+)
+
+func TestPrometheusHandler(t *testing.T) {
+	handler := PrometheusHandler()
+	defer func() {
+		exporter.enabled = 0
+		exporter.transactions = make(map[aggregatorKey]*promTransaction)
+		exporter.events = make(map[aggregatorKey]*promEvent)
+		exporter.metrics = make(map[string]*promMetric)
+	}()
+
+	trans := message.NewTransaction("URL", "/foo", nil)
+	trans.SetDuration(150 * time.Millisecond)
+	trans.LogEvent("Remote", "call", "fail")
+	trans.Complete()
+	exporter.observe(trans)
+
+	aggregator.metric.AddCount("orders", 2)
+	aggregator.metric.AddDuration("latency", time.Second)
+
+	aggregator.transaction.collectAndSend()
+	aggregator.event.collectAndSend()
+	aggregator.metric.collectAndSend()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(recorder.Body)
+
+	for _, expected := range []string{
+		`cat_transaction_duration_milliseconds_bucket{type="URL",name="/foo",le="20"} 0`,
+		`cat_transaction_duration_milliseconds_bucket{type="URL",name="/foo",le="200"} 1`,
+		`cat_transaction_duration_milliseconds_sum{type="URL",name="/foo"} 150`,
+		`cat_event_failures_total{type="Remote",name="call"} 1`,
+		`cat_metric_count_total{name="orders"} 2`,
+		`cat_metric_duration_milliseconds_sum{name="latency"} 1000`,
+	} {
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("%q not found in:\n%s", expected, body)
+		}
+	}
+}
+
+func TestPrometheusSeriesLimit(t *testing.T) {
+	series := make(map[string]*promMetric)
+	for i := 0; i < promMaxSeries+10; i++ {
+		promSeries(series, strconv.Itoa(i), promOverflowName).count++
+	}
+
+	if len(series) != promMaxSeries+1 {
+		t.Errorf("%d series are kept, %d expected", len(series), promMaxSeries+1)
+	}
+	if count := series[promOverflowName].count; count != 10 {
+		t.Errorf("%d overflowing names are counted, 10 expected", count)
+	}
+}
+
+func TestDurationBoundaries(t *testing.T) {
+	for i, tier := range durationTiers {
+		if durationBoundaries[i+1] != int64(tier.limit) {
+			t.Errorf("boundary %d is %d, %d expected", i+1, durationBoundaries[i+1], tier.limit)
+		}
+		if duration := computeDuration(tier.limit - 1); duration >= tier.limit {
+			t.Errorf("%d is rounded to %d, beyond its tier", tier.limit-1, duration)
+		}
+	}
+}
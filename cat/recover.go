@@ -0,0 +1,66 @@
+package cat
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/xiaobudongzhang/cat-go/message"
+)
+
+// Recover recovers from a panic, if any, marking t as failed and completing it.
+// The panic value and the stack it has been raised from are logged as an Error event of t.
+// It must be deferred directly:
+//
+//	defer cat.Recover(t)
+func Recover(t message.Transactor) {
+	if r := recover(); r != nil {
+		fail(t, r)
+	}
+}
+
+// RecoverAndRepanic does the same as Recover, then panics again with the recovered value.
+//
+//	defer cat.RecoverAndRepanic(t)
+func RecoverAndRepanic(t message.Transactor) {
+	if r := recover(); r != nil {
+		fail(t, r)
+		panic(r)
+	}
+}
+
+// Go runs fn in a new goroutine, within a transaction completed once fn has returned.
+// The transaction is the root of a tree forked from the current tree of ctx, see Fork,
+// so that it may outlive the caller's transaction.
+// It fails if fn returns an error or panics, in which case the panic is recovered,
+// otherwise it keeps the status fn may have set, SUCCESS by default.
+func Go(ctx context.Context, mtype, name string, fn func(ctx context.Context) error) {
+	ctx, t := Fork(ctx, mtype, name)
+
+	go func() {
+		defer Recover(t)
+
+		if err := fn(ctx); err != nil {
+			t.SetStatus(FAIL)
+			t.AddData("error", err.Error())
+		}
+		t.Complete()
+	}()
+}
+
+func fail(t message.Transactor, r interface{}) {
+	err, ok := r.(error)
+	if !ok {
+		err = fmt.Errorf("%v", r)
+	}
+
+	if t == nil {
+		LogErrorWithCategory(err, namePanic)
+		return
+	}
+
+	// skips fail and the deferred Recover.
+	t.LogEvent(typeError, namePanic, message.CatError, newStacktrace(3, err).String())
+
+	t.SetStatus(FAIL)
+	t.Complete()
+}
@@ -0,0 +1,105 @@
+package cat
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xiaobudongzhang/cat-go/message"
+)
+
+func panicking(t message.Transactor) {
+	defer Recover(t)
+	panic("boom")
+}
+
+func TestRecover(t *testing.T) {
+	trans := message.NewTransaction("Job", "panic", nil)
+	panicking(trans)
+
+	if trans.GetStatus() != FAIL || trans.GetDuration() == 0 {
+		t.Errorf("the transaction should have failed and been completed: %s", trans.GetStatus())
+	}
+	children := trans.GetChildren()
+	if len(children) != 1 || children[0].GetType() != typeError || children[0].GetName() != namePanic {
+		t.Fatalf("an Error event should have been logged: %+v", children)
+	}
+	data := children[0].GetData().String()
+	if !strings.HasPrefix(data, "boom\n") || !strings.Contains(data, "cat.panicking") {
+		t.Errorf("the stack should lead to the panic:\n%s", data)
+	}
+}
+
+func TestRecoverAndRepanic(t *testing.T) {
+	trans := message.NewTransaction("Job", "panic", nil)
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Errorf("unexpected panic: %v", r)
+		}
+		if trans.GetStatus() != FAIL {
+			t.Error("the transaction should have failed")
+		}
+	}()
+
+	defer RecoverAndRepanic(trans)
+	panic("boom")
+}
+
+func TestGo(t *testing.T) {
+	enable()
+	defer disable()
+
+	done := make(chan *message.Transaction, 3)
+	defer AddFlushHook(func(m message.Messager) {
+		if trans, ok := m.(*message.Transaction); ok && trans.GetType() == "Worker" {
+			select {
+			case done <- trans:
+			default:
+			}
+		}
+	})()
+
+	ctx, root := StartTransaction(context.Background(), "URL", "/foo")
+	Go(ctx, "Worker", "panic", func(ctx context.Context) error {
+		panic(errors.New("boom"))
+	})
+	Go(ctx, "Worker", "error", func(ctx context.Context) error {
+		if TransactionFromContext(ctx) == nil {
+			t.Error("the context should carry the worker's transaction")
+		}
+		return errors.New("failed")
+	})
+	Go(ctx, "Worker", "status", func(ctx context.Context) error {
+		TransactionFromContext(ctx).SetStatus("timeout")
+		return nil
+	})
+	root.Complete()
+
+	links := make(map[string]bool)
+	for _, child := range root.(*message.Transaction).GetChildren() {
+		if child.GetType() != typeRemoteCall || child.GetName() != nameForked {
+			t.Errorf("workers should not be nested in the caller's transaction: %s", child.GetType())
+		}
+		links[child.GetData().String()] = true
+	}
+
+	rootId := createHeader(root.GetCtx()).MessageId
+	for i := 0; i < 3; i++ {
+		select {
+		case trans := <-done:
+			if trans.GetName() == "status" && trans.GetStatus() != "timeout" {
+				t.Errorf("the status set by the worker should be kept: %s", trans.GetStatus())
+			} else if trans.GetName() != "status" && trans.GetStatus() != FAIL {
+				t.Errorf("%s should have failed: %s", trans.GetName(), trans.GetStatus())
+			}
+			header := createHeader(trans.GetCtx())
+			if header.ParentMessageId != rootId || !links[header.MessageId] {
+				t.Errorf("%s should be forked from the caller's tree: %+v", trans.GetName(), header)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("the workers' transactions have not been flushed")
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package cat
 
 import (
+	"bytes"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
@@ -12,9 +13,15 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"sync/atomic"
 	"time"
 )
 
+const (
+	RouterFormatJson = "json"
+	RouterFormatXml  = "xml"
+)
+
 type routerConfigXMLProperty struct {
 	XMLName xml.Name `xml:"property"`
 	Id      string   `xml:"id,attr"`
@@ -32,17 +39,25 @@ type routerConfigJson struct {
 
 type catRouterConfig struct {
 	scheduleMixin
-	sample  float64
-	routers []serverAddress
-	current *serverAddress
-	ticker  *time.Ticker
+	// policies holds the *routerPolicy of the properties last pushed.
+	policies  atomic.Value
+	routers   []serverAddress
+	current   *serverAddress
+	ticker    *time.Ticker
+	probe     *time.Ticker
+	retry     *time.Timer
+	resets    chan struct{}
+	backoff   time.Duration
+	connected time.Time
+	stats     routerStats
 }
 
 var router = catRouterConfig{
 	scheduleMixin: makeScheduleMixedIn(signalRouterExit),
-	sample:        1.0,
 	routers:       make([]serverAddress, 0),
 	ticker:        nil,
+	resets:        make(chan struct{}, 1),
+	backoff:       routerBackoffMin,
 }
 
 func (c *catRouterConfig) GetName() string {
@@ -57,10 +72,16 @@ func (c *catRouterConfig) updateRouterConfig() {
 		query.Add("domain", config.domain)
 		query.Add("ip", config.ip)
 		query.Add("hostname", config.hostname)
-		query.Add("op", "json")
+		// both formats are parsed, whichever the server answers with.
+		query.Add("op", config.routerFormat)
+
+		var scheme = "http"
+		if config.tlsConfig != nil {
+			scheme = "https"
+		}
 
 		u = &url.URL{
-			Scheme:   "http",
+			Scheme:   scheme,
 			Path:     "/cat/s/router",
 			RawQuery: query.Encode(),
 		}
@@ -68,124 +89,185 @@ func (c *catRouterConfig) updateRouterConfig() {
 		u, _ = url.Parse(config.router)
 	}
 
-	client := http.Client{
-		Timeout: 5 * time.Second,
-	}
+	client := newHttpClient(5 * time.Second)
 
 	if config.router == "" {
 		for _, server := range config.serverAddress {
-			u.Host = fmt.Sprintf("%s:%d", server.Host, server.HttpPort)
-			logger.Info("Getting router config from %s", u.String())
-
-			resp, err := client.Get(u.String())
-			if err != nil {
-				logger.Warning("Error occurred while getting router config from url %s", u.String())
-				continue
-			}
-
-			err = c.parse(resp.Body)
-			if err == nil {
-				return
-			} else {
+			u.Host = net.JoinHostPort(server.Host, strconv.Itoa(server.HttpPort))
+			if err := c.fetch(client, u.String()); err != nil {
+				logger.Warning("Error occurred while getting router config from url %s: %s", u.String(), err)
 				continue
 			}
-		}
-	} else {
-		resp, err := client.Get(u.String())
-		if err != nil {
-			logger.Warning("Error occurred while getting router config from url %s", u.String())
 			return
 		}
-
-		err = c.parse(resp.Body)
+	} else {
+		err := c.fetch(client, u.String())
 		if err == nil {
 			return
 		}
+		logger.Warning("Error occurred while getting router config from url %s: %s", u.String(), err)
 	}
 
 	logger.Error("Can't get router config from remote server.")
 	return
 }
 
+func (c *catRouterConfig) fetch(client *http.Client, u string) error {
+	logger.Info("Getting router config from %s", u)
+
+	resp, err := client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unexpected status: %s", resp.Status)
+	}
+	return c.parse(resp.Body)
+}
+
 func (c *catRouterConfig) handle(signal int) {
 	switch signal {
 	case signalResetConnection:
 		logger.Warning("Connection has been reset, reconnecting.")
+		if c.current != nil {
+			c.transit(routerTransitionDisconnected, c.current)
+		}
 		c.current = nil
-		c.updateRouterConfig()
+		if time.Since(c.connected) > routerBackoffMax {
+			c.backoff = routerBackoffMin
+		}
+		c.scheduleRetry()
 	default:
 		c.scheduleMixin.handle(signal)
 	}
 }
 
+// resetConnection notifies the router that the current connection is broken.
+// It never blocks, pending notifications are coalesced.
+func (c *catRouterConfig) resetConnection() {
+	select {
+	case c.resets <- struct{}{}:
+	default:
+	}
+}
+
 func (c *catRouterConfig) afterStart() {
 	c.ticker = time.NewTicker(time.Minute * 3)
+	c.probe = time.NewTicker(routerProbeInterval)
 	c.updateRouterConfig()
 }
 
 func (c *catRouterConfig) beforeStop() {
 	c.ticker.Stop()
+	c.probe.Stop()
+	if c.retry != nil {
+		c.retry.Stop()
+	}
+}
+
+func (c *catRouterConfig) retryC() <-chan time.Time {
+	if c.retry == nil {
+		return nil
+	}
+	return c.retry.C
 }
 
 func (c *catRouterConfig) process() {
 	select {
 	case sig := <-c.signals:
 		c.handle(sig)
+	case <-c.resets:
+		c.handle(signalResetConnection)
 	case <-c.ticker.C:
 		c.updateRouterConfig()
+	case <-c.probe.C:
+		c.failback()
+	case <-c.retryC():
+		c.retry = nil
+		if len(c.routers) == 0 {
+			c.updateRouterConfig()
+		} else {
+			c.connect()
+		}
+	}
+}
+
+func (c *catRouterConfig) policy() *routerPolicy {
+	if policy, ok := c.policies.Load().(*routerPolicy); ok {
+		return policy
 	}
+	return defaultRouterPolicy
 }
 
-func (c *catRouterConfig) updateSample(v string) error {
-	sample, err := strconv.ParseFloat(v, 32)
+func (c *catRouterConfig) updatePolicy(properties map[string]string) error {
+	current := c.policy()
+	policy, err := newRouterPolicy(current, properties)
 	if err != nil {
-		logger.Warning("Sample should be a valid float, %s given", v)
 		return err
-	} else if math.Abs(sample-c.sample) > 1e-9 {
-		c.sample = sample
-		logger.Info("Sample rate has been set to %f%%", c.sample*100)
 	}
+
+	if math.Abs(policy.sample-current.sample) > 1e-9 {
+		logger.Info("Sample rate has been set to %f%%", policy.sample*100)
+	}
+	c.policies.Store(policy)
 	return nil
 }
 
+// updateBlock blocks the client unless v is false, a client disabled locally remaining so.
 func (c *catRouterConfig) updateBlock(v string) {
-	if v == "false" {
-		enable()
-	} else {
-		disable()
-	}
+	setDisabled(disabledByRouter, v != "false")
 }
 
-func (c *catRouterConfig) parse(reader io.ReadCloser) error {
-	bytes, err := ioutil.ReadAll(reader)
+// parse applies the properties of a router config, either json or xml.
+func (c *catRouterConfig) parse(reader io.Reader) error {
+	content, err := ioutil.ReadAll(reader)
 	if err != nil {
 		return err
 	}
 
-	t := new(routerConfigJson)
-	if err := json.Unmarshal(bytes, &t); err != nil {
-		logger.Warning("Error occurred while parsing router config json content.\n%s", string(bytes))
+	properties, err := decodeRouterConfig(content)
+	if err != nil {
+		logger.Warning("Error occurred while parsing router config content.\n%s", string(content))
+		return err
 	}
 
-	for k, v := range t.Kvs {
-		switch k {
-		case propertySample:
-			err = c.updateSample(v)
-			if err != nil {
-				return err
-			}
-		case propertyRouters:
-			err = c.updateRouters(v)
-			if err != nil {
-				return err
-			}
-		case propertyBlock:
-			c.updateBlock(v)
+	if err = c.updatePolicy(properties); err != nil {
+		return err
+	}
+	if v, ok := properties[propertyRouters]; ok {
+		if err = c.updateRouters(v); err != nil {
+			return err
 		}
 	}
+	if v, ok := properties[propertyBlock]; ok {
+		c.updateBlock(v)
+	}
 	return nil
 }
 
+func decodeRouterConfig(content []byte) (map[string]string, error) {
+	if trimmed := bytes.TrimSpace(content); len(trimmed) > 0 && trimmed[0] == '<' {
+		t := new(routerConfigXML)
+		if err := xml.Unmarshal(trimmed, t); err != nil {
+			return nil, err
+		}
+
+		properties := make(map[string]string, len(t.Properties))
+		for _, property := range t.Properties {
+			properties[property.Id] = property.Value
+		}
+		return properties, nil
+	}
+
+	t := new(routerConfigJson)
+	if err := json.Unmarshal(content, t); err != nil {
+		return nil, err
+	}
+	return t.Kvs, nil
+}
+
 func (c *catRouterConfig) updateRouters(router string) error {
 	newRouters := resolveServerAddresses(router)
 
@@ -209,23 +291,15 @@ func (c *catRouterConfig) updateRouters(router string) error {
 		}
 	}
 
-	for _, server := range newRouters {
-		if compareServerAddress(c.current, &server) {
-			return nil
-		}
-
-		addr := fmt.Sprintf("%s:%d", server.Host, server.Port)
-		if conn, err := net.DialTimeout("tcp", addr, time.Second); err != nil {
-			logger.Info("Failed to connect to %s, retrying...", addr)
-			return errors.New("Failed to connect to " + addr)
-		} else {
-			c.current = &server
-			logger.Info("Connected to %s.", addr)
-			sender.chConn <- conn
-			return nil
+	if c.current != nil {
+		for _, server := range c.routers {
+			if compareServerAddress(c.current, &server) {
+				return nil
+			}
 		}
+		logger.Info("Current server %s is no longer in routers.", c.current)
 	}
 
-	logger.Info("Cannot established a connection to cat server.")
+	c.connect()
 	return nil
 }
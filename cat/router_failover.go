@@ -0,0 +1,162 @@
+package cat
+
+import (
+	"math/rand"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	routerTransitionConnected     = "Connected"
+	routerTransitionFailover      = "Failover"
+	routerTransitionFailback      = "Failback"
+	routerTransitionDisconnected  = "Disconnected"
+	routerTransitionConnectFailed = "ConnectFailed"
+)
+
+var routerTransitions = []string{
+	routerTransitionConnected,
+	routerTransitionFailover,
+	routerTransitionFailback,
+	routerTransitionDisconnected,
+	routerTransitionConnectFailed,
+}
+
+type routerStats struct {
+	connected,
+	failover,
+	failback,
+	disconnected,
+	connectFailed uint64
+}
+
+func (s *routerStats) counter(transition string) *uint64 {
+	switch transition {
+	case routerTransitionConnected:
+		return &s.connected
+	case routerTransitionFailover:
+		return &s.failover
+	case routerTransitionFailback:
+		return &s.failback
+	case routerTransitionDisconnected:
+		return &s.disconnected
+	default:
+		return &s.connectFailed
+	}
+}
+
+func (s *routerStats) get(transition string) uint64 {
+	return atomic.LoadUint64(s.counter(transition))
+}
+
+// transit logs and counts a state transition of the connection to server.
+func (c *catRouterConfig) transit(transition string, server *serverAddress) {
+	atomic.AddUint64(c.stats.counter(transition), 1)
+	logger.Info("Router %s: %s", transition, server)
+	LogEvent(typeSystem, "Router."+transition, SUCCESS, server.String())
+}
+
+// preferred returns the index of the server this client should be connected to when all of them are healthy.
+// It is the first router, unless load balance is enabled, in which case the clients are spread by their ip.
+func (c *catRouterConfig) preferred() int {
+	if len(c.routers) == 0 || !config.loadBalance {
+		return 0
+	}
+	return int(hasher(config.ip+config.hostname) % uint32(len(c.routers)))
+}
+
+// candidates returns all the routers in the order they should be tried, starting from the preferred one.
+func (c *catRouterConfig) candidates() []serverAddress {
+	var n = len(c.routers)
+	var start = c.preferred()
+
+	servers := make([]serverAddress, 0, n)
+	for i := 0; i < n; i++ {
+		servers = append(servers, c.routers[(start+i)%n])
+	}
+	return servers
+}
+
+func (c *catRouterConfig) dial(server serverAddress) (net.Conn, error) {
+	conn, err := dialServer(server.String(), routerDialTimeout)
+	if err != nil {
+		c.transit(routerTransitionConnectFailed, &server)
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (c *catRouterConfig) switchTo(server serverAddress, conn net.Conn, transition string) {
+	c.current = &server
+	c.connected = time.Now()
+	c.backoff = routerBackoffMin
+	if c.retry != nil {
+		c.retry.Stop()
+		c.retry = nil
+	}
+	c.transit(transition, &server)
+	sender.chTransport <- newTcpTransport(conn)
+}
+
+// connect tries every router in order until a connection is established.
+// If all of them failed, a reconnection is scheduled with exponential backoff.
+func (c *catRouterConfig) connect() {
+	if config.transport != nil {
+		return
+	}
+
+	servers := c.candidates()
+
+	for i, server := range servers {
+		conn, err := c.dial(server)
+		if err != nil {
+			logger.Warning("Failed to connect to %s: %s", server, err)
+			continue
+		}
+
+		if i == 0 {
+			c.switchTo(server, conn, routerTransitionConnected)
+		} else {
+			c.switchTo(server, conn, routerTransitionFailover)
+		}
+		return
+	}
+
+	logger.Error("Cannot establish a connection to any cat server.")
+	c.scheduleRetry()
+}
+
+// failback probes the preferred router and switches back to it once it is reachable again.
+func (c *catRouterConfig) failback() {
+	if config.transport != nil || c.current == nil || len(c.routers) == 0 {
+		return
+	}
+
+	server := c.routers[c.preferred()]
+	if compareServerAddress(c.current, &server) {
+		return
+	}
+
+	conn, err := c.dial(server)
+	if err != nil {
+		logger.Info("Preferred server %s is still unavailable.", server)
+		return
+	}
+	c.switchTo(server, conn, routerTransitionFailback)
+}
+
+func (c *catRouterConfig) scheduleRetry() {
+	if c.retry != nil {
+		return
+	}
+
+	// equal jitter, keeps at least half of the backoff to avoid reconnecting in a tight loop.
+	delay := c.backoff/2 + time.Duration(rand.Int63n(int64(c.backoff/2)+1))
+	logger.Info("Reconnecting in %s.", delay)
+	c.retry = time.NewTimer(delay)
+
+	if c.backoff *= 2; c.backoff > routerBackoffMax {
+		c.backoff = routerBackoffMax
+	}
+}
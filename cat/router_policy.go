@@ -0,0 +1,122 @@
+package cat
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// routerPolicy holds the properties pushed by the server which the messages flushed are subject to.
+// It is replaced as a whole by the router goroutine, and read by any other.
+type routerPolicy struct {
+	sample float64
+	// typeSamples are the sample rates overriding sample for the transactions of a type.
+	typeSamples map[string]*typeSample
+
+	// the successful transactions of atomic types, starting with one of startTypes or being one of matchTypes,
+	// are sent merged into a single tree once sampled, rather than one by one.
+	startTypes []string
+	matchTypes map[string]bool
+}
+
+type typeSample struct {
+	rate   float64
+	offset uint32
+}
+
+var defaultRouterPolicy = &routerPolicy{sample: 1.0}
+
+func (p *routerPolicy) isAtomic(mtype string) bool {
+	if p.matchTypes[mtype] {
+		return true
+	}
+	for _, prefix := range p.startTypes {
+		if strings.HasPrefix(mtype, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// newRouterPolicy returns the policy of the properties pushed by the server, the sample rate being kept
+// from current if it is not pushed.
+func newRouterPolicy(current *routerPolicy, properties map[string]string) (*routerPolicy, error) {
+	var policy = &routerPolicy{sample: current.sample}
+
+	for k, v := range properties {
+		switch {
+		case k == propertySample:
+			sample, err := parseSample(v)
+			if err != nil {
+				return nil, err
+			}
+			policy.sample = sample
+		case strings.HasPrefix(k, propertyTypeSample):
+			sample, err := parseSample(v)
+			if err != nil {
+				return nil, err
+			}
+			if policy.typeSamples == nil {
+				policy.typeSamples = make(map[string]*typeSample)
+			}
+			policy.typeSamples[strings.TrimPrefix(k, propertyTypeSample)] = &typeSample{rate: sample}
+		case k == propertyStartTransactionTypes:
+			policy.startTypes = splitTypes(v)
+		case k == propertyMatchTransactionTypes:
+			for _, mtype := range splitTypes(v) {
+				if policy.matchTypes == nil {
+					policy.matchTypes = make(map[string]bool)
+				}
+				policy.matchTypes[mtype] = true
+			}
+		}
+	}
+	return policy, nil
+}
+
+func parseSample(v string) (float64, error) {
+	sample, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		logger.Warning("Sample should be a valid float, %s given", v)
+		return 0, err
+	}
+	return sample, nil
+}
+
+// splitTypes splits the types separated by semicolons or commas.
+func splitTypes(v string) []string {
+	var types []string
+	for _, mtype := range strings.FieldsFunc(v, func(r rune) bool { return r == ';' || r == ',' }) {
+		if mtype = strings.TrimSpace(mtype); mtype != "" {
+			types = append(types, mtype)
+		}
+	}
+	return types
+}
+
+// sample tells whether a successful transaction of mtype is sent rather than aggregated.
+func (p *catMessageManager) sample(policy *routerPolicy, mtype string) bool {
+	if s, ok := policy.typeSamples[mtype]; ok {
+		return hitSample(&s.offset, s.rate)
+	}
+	return hitSample(&p.offset, policy.sample)
+}
+
+func hitSample(offset *uint32, sampleRate float64) bool {
+	if sampleRate > 1.0 {
+		return true
+	} else if sampleRate < 1e-9 {
+		return false
+	}
+	var cycle = uint32(1 / sampleRate)
+
+	var current, next uint32
+	for {
+		current = atomic.LoadUint32(offset)
+		next = (current + 1) % cycle
+		if atomic.CompareAndSwapUint32(offset, current, next) {
+			break
+		}
+	}
+	return next == 0
+}
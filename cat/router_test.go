@@ -0,0 +1,237 @@
+package cat
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func listenServer(t *testing.T) (net.Listener, serverAddress) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return l, serverAddress{Host: host, Port: p}
+}
+
+func receiveTransport(t *testing.T) Transport {
+	select {
+	case transport := <-sender.chTransport:
+		return transport
+	case <-time.After(time.Second * 3):
+		t.Fatal("no connection has been handed to the sender")
+		return nil
+	}
+}
+
+func TestRouterFailoverAndFailback(t *testing.T) {
+	dead, deadAddr := listenServer(t)
+	_ = dead.Close()
+
+	alive, aliveAddr := listenServer(t)
+	defer alive.Close()
+
+	c := &catRouterConfig{
+		routers: []serverAddress{deadAddr, aliveAddr},
+		backoff: routerBackoffMin,
+	}
+
+	go c.connect()
+	transport := receiveTransport(t)
+	transport.Close()
+
+	if !compareServerAddress(c.current, &aliveAddr) {
+		t.Fatalf("expected to fail over to %s, got %v", aliveAddr, c.current)
+	}
+	if c.stats.get(routerTransitionFailover) != 1 || c.stats.get(routerTransitionConnectFailed) != 1 {
+		t.Errorf("unexpected stats: %+v", c.stats)
+	}
+
+	// the preferred server comes back.
+	preferred, err := net.Listen("tcp", deadAddr.String())
+	if err != nil {
+		t.Skip("cannot listen on the previous port again:", err)
+	}
+	defer preferred.Close()
+
+	go c.failback()
+	transport = receiveTransport(t)
+	transport.Close()
+
+	if !compareServerAddress(c.current, &deadAddr) || c.stats.get(routerTransitionFailback) != 1 {
+		t.Fatalf("expected to fail back to %s, got %v", deadAddr, c.current)
+	}
+}
+
+func TestRouterBackoff(t *testing.T) {
+	dead, deadAddr := listenServer(t)
+	_ = dead.Close()
+
+	c := &catRouterConfig{
+		routers: []serverAddress{deadAddr},
+		backoff: routerBackoffMin,
+	}
+
+	for i := 0; i < 10; i++ {
+		c.connect()
+		if c.retry == nil {
+			t.Fatal("a retry should have been scheduled")
+		}
+		c.retry.Stop()
+		c.retry = nil
+	}
+	if c.backoff != routerBackoffMax {
+		t.Errorf("backoff should be capped at %s, got %s", routerBackoffMax, c.backoff)
+	}
+}
+
+func TestRouterParse(t *testing.T) {
+	contents := map[string]string{
+		"json": `{"kvs": {"sample": "0.5", "sample.URL": "0.01", "startTransactionTypes": "Cache.;Squirrel.", "matchTransactionTypes": "SQL, Redis"}}`,
+		"xml": `<?xml version="1.0" encoding="utf-8"?>
+<property-config>
+    <property id="sample" value="0.5"/>
+    <property id="sample.URL" value="0.01"/>
+    <property id="startTransactionTypes" value="Cache.;Squirrel."/>
+    <property id="matchTransactionTypes" value="SQL, Redis"/>
+</property-config>`,
+	}
+
+	for format, content := range contents {
+		c := &catRouterConfig{}
+		if err := c.parse(strings.NewReader(content)); err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+
+		policy := c.policy()
+		if policy.sample != 0.5 || policy.typeSamples["URL"].rate != 0.01 {
+			t.Errorf("%s: unexpected sample rates: %+v", format, policy)
+		}
+		for mtype, atomic := range map[string]bool{"Cache.get": true, "Squirrel.set": true, "SQL": true, "Redis": true, "SQL.select": false, "URL": false} {
+			if policy.isAtomic(mtype) != atomic {
+				t.Errorf("%s: %s should be atomic: %v", format, mtype, atomic)
+			}
+		}
+	}
+}
+
+func TestRouterParseInvalid(t *testing.T) {
+	c := &catRouterConfig{}
+	for _, content := range []string{`{"kvs": `, `<property-config>`, `{"kvs": {"sample": "all"}}`} {
+		if err := c.parse(strings.NewReader(content)); err == nil {
+			t.Errorf("%s should be rejected", content)
+		}
+	}
+	if c.policy() != defaultRouterPolicy {
+		t.Error("the policy should not have changed")
+	}
+
+	// properties not pushed anymore are reset, but the sample rate.
+	_ = c.parse(strings.NewReader(`{"kvs": {"sample": "0.5", "sample.URL": "0.01", "matchTransactionTypes": "SQL"}}`))
+	_ = c.parse(strings.NewReader(`{"kvs": {}}`))
+	if policy := c.policy(); policy.sample != 0.5 || len(policy.typeSamples) != 0 || policy.isAtomic("SQL") {
+		t.Errorf("unexpected policy: %+v", policy)
+	}
+}
+
+func TestRouterFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/router" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"kvs": {"sample": "0.25"}}`))
+	}))
+	defer server.Close()
+
+	c := &catRouterConfig{}
+	if err := c.fetch(server.Client(), server.URL+"/missing"); err == nil {
+		t.Error("a response other than 200 should be rejected")
+	}
+	if err := c.fetch(server.Client(), server.URL+"/router"); err != nil || c.policy().sample != 0.25 {
+		t.Errorf("the router config should have been applied: %v", err)
+	}
+}
+
+func TestRouterFormat(t *testing.T) {
+	formats := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		formats <- r.URL.Query().Get("op")
+		_, _ = w.Write([]byte(`<property-config><property id="sample" value="1"/></property-config>`))
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(u.Port())
+	saved := config
+	defer func() {
+		config = saved
+	}()
+	config.routerFormat = RouterFormatXml
+	config.serverAddress = []serverAddress{{Host: u.Hostname(), HttpPort: port}}
+
+	c := &catRouterConfig{}
+	c.updateRouterConfig()
+	if format := <-formats; format != RouterFormatXml {
+		t.Errorf("the xml format should have been requested: %s", format)
+	}
+}
+
+func TestRouterIPv6(t *testing.T) {
+	listener, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 is not available:", err)
+	}
+	hosts := make(chan string, 1)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts <- r.Host
+		_, _ = w.Write([]byte(`{"kvs": {"sample": "0.25"}}`))
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	saved := config
+	defer func() {
+		config = saved
+	}()
+	config.routerFormat = RouterFormatJson
+	config.serverAddress = []serverAddress{{Host: "::1", HttpPort: listener.Addr().(*net.TCPAddr).Port}}
+
+	c := &catRouterConfig{}
+	c.updateRouterConfig()
+	if c.policy().sample != 0.25 {
+		t.Fatal("the router config should have been fetched from the IPv6 server")
+	}
+	if host := <-hosts; host != listener.Addr().String() {
+		t.Errorf("the IPv6 address should be bracketed in the router url: %s", host)
+	}
+}
+
+func TestManagerTypeSample(t *testing.T) {
+	policy, _ := newRouterPolicy(defaultRouterPolicy, map[string]string{
+		"sample.URL":            "0.5",
+		"matchTransactionTypes": "SQL",
+	})
+
+	m := &catMessageManager{}
+	var sent int
+	for i := 0; i < 100; i++ {
+		if m.sample(policy, "URL") {
+			sent++
+		}
+	}
+	if sent != 50 {
+		t.Errorf("half of the URL transactions should have been sent: %d", sent)
+	}
+	if !m.sample(policy, "Service") {
+		t.Error("the other types should be sampled by the global rate")
+	}
+}
@@ -1,7 +1,9 @@
 package cat
 
+import "sync/atomic"
+
 type scheduleMixin struct {
-	isAlive    bool
+	isAlive    uint32
 	signals    chan int
 	exitSignal int
 }
@@ -21,7 +23,19 @@ type scheduleMixer interface {
 func (p *scheduleMixin) handle(signal int) {
 	switch signal {
 	case signalShutdown:
-		p.isAlive = false
+		p.setAlive(false)
+	}
+}
+
+func (p *scheduleMixin) alive() bool {
+	return atomic.LoadUint32(&p.isAlive) == 1
+}
+
+func (p *scheduleMixin) setAlive(alive bool) {
+	if alive {
+		atomic.StoreUint32(&p.isAlive, 1)
+	} else {
+		atomic.StoreUint32(&p.isAlive, 0)
 	}
 }
 
@@ -44,10 +58,10 @@ func (p *scheduleMixin) getScheduleMixin() *scheduleMixin {
 func background(p scheduleMixer) {
 	mixin := p.getScheduleMixin()
 
-	mixin.isAlive = true
+	mixin.setAlive(true)
 	p.afterStart()
 
-	for mixin.isAlive {
+	for mixin.alive() {
 		p.process()
 	}
 
@@ -59,7 +73,7 @@ func background(p scheduleMixer) {
 
 func makeScheduleMixedIn(exitSignal int) scheduleMixin {
 	return scheduleMixin{
-		isAlive:    false,
+		isAlive:    0,
 		signals:    make(chan int),
 		exitSignal: exitSignal,
 	}
@@ -79,7 +93,7 @@ func (p *catScheduler) shutdownAndWaitGroup(items []scheduleMixer) {
 
 	for _, v := range items {
 		mixin := v.getScheduleMixin()
-		if mixin.isAlive {
+		if mixin.alive() {
 			mixin.signals <- signalShutdown
 			expectedSignals[mixin.exitSignal] = v.GetName()
 			count++
@@ -106,7 +120,7 @@ func (p *catScheduler) shutdownAndWaitGroup(items []scheduleMixer) {
 func (p *catScheduler) shutdown() {
 	group1 := []scheduleMixer{&router, &monitor}
 	group2 := []scheduleMixer{aggregator.transaction, aggregator.event, aggregator.metric}
-	group3 := []scheduleMixer{&sender}
+	group3 := []scheduleMixer{sender}
 
 	disable()
 
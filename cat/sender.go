@@ -1,16 +1,20 @@
 package cat
 
 import (
-	"bytes"
 	"context"
-	"encoding/binary"
-	"net"
+	"sync"
 	"time"
 
 	"github.com/xiaobudongzhang/cat-go/message"
 )
 
 func createHeader(ctx context.Context) *message.Header {
+	var header = &message.Header{}
+	fillHeader(header, ctx)
+	return header
+}
+
+func fillHeader(header *message.Header, ctx context.Context) {
 	var rootMessageId, parentMessageId, messageId string
 	if ctx != nil {
 		if id, exists := ctx.Value(CatContextRootMessageId).(string); exists {
@@ -28,27 +32,45 @@ func createHeader(ctx context.Context) *message.Header {
 		messageId = Manager.NextId()
 	}
 
-	return &message.Header{
+	*header = message.Header{
 		Domain:          config.domain,
 		Hostname:        config.hostname,
 		Ip:              config.ip,
 		MessageId:       messageId,
 		ParentMessageId: parentMessageId,
 		RootMessageId:   rootMessageId,
+		SessionToken:    config.sessionToken,
 	}
 }
 
 type catMessageSender struct {
 	scheduleMixin
 
-	normal  chan message.Messager
-	high    chan message.Messager
-	chConn  chan net.Conn
-	encoder message.Encoder
+	normal      chan message.Messager
+	high        chan message.Messager
+	atomic      chan *message.Transaction
+	chTransport chan Transport
+	encoder     message.Encoder
+
+	// header is reused by every message sent, which the sender goroutine only does.
+	header message.Header
+
+	transport Transport
+	// fixed is set if the transport is given by the configuration rather than the router.
+	fixed bool
+
+	// flushes receives the flush requests, pending until every message queued before them has been written.
+	flushes chan chan struct{}
+	pending []chan struct{}
 
-	buf *bytes.Buffer
+	// ready is closed once the first transport has been received.
+	ready     chan struct{}
+	readyOnce sync.Once
 
-	conn net.Conn
+	// merging holds the transactions of atomic types, sent together as a single tree once there are enough of them
+	// or every tick of merger.
+	merging []message.Messager
+	merger  *time.Ticker
 }
 
 func (s *catMessageSender) GetName() string {
@@ -56,39 +78,122 @@ func (s *catMessageSender) GetName() string {
 }
 
 func (s *catMessageSender) send(m message.Messager) {
-	var buf = s.buf
-	buf.Reset()
+	defer releaseMessage(m)
+
+	if s.transport == nil {
+		return
+	}
+
+	var buf = getBuffer()
+	defer putBuffer(buf)
 
-	var header = createHeader(m.GetCtx())
-	if err := s.encoder.EncodeHeader(buf, header); err != nil {
+	fillHeader(&s.header, m.GetCtx())
+	if err := s.encoder.EncodeHeader(buf, &s.header); err != nil {
 		return
 	}
 	if err := s.encoder.EncodeMessage(buf, m); err != nil {
 		return
 	}
 
-	var b = make([]byte, 4)
-	binary.BigEndian.PutUint32(b, uint32(buf.Len()))
+	if err := s.transport.Send(buf.Bytes()); err != nil {
+		if s.fixed {
+			logger.Warning("Error occurred while sending data: %s", err)
+			return
+		}
+		logger.Warning("Error occurred while writing data, connection has been dropped.")
+		s.dropTransport()
+	}
+}
 
-	if err := s.conn.SetWriteDeadline(time.Now().Add(time.Second * 3)); err != nil {
-		logger.Warning("Error occurred while setting write deadline, connection has been dropped.")
-		s.conn = nil
-		router.signals <- signalResetConnection
+func (s *catMessageSender) dropTransport() {
+	s.transport.Close()
+	s.transport = nil
+	router.resetConnection()
+}
+
+func (s *catMessageSender) setTransport(transport Transport) {
+	logger.Info("Received a new transport: %s", transport)
+	if s.transport != nil {
+		s.transport.Close()
 	}
+	s.transport = transport
+	s.setReady()
 
-	if _, err := s.conn.Write(b); err != nil {
-		logger.Warning("Error occurred while writing data, connection has been dropped.")
-		s.conn = nil
-		router.signals <- signalResetConnection
-		return
+	if len(s.pending) > 0 {
+		s.flushPending()
 	}
-	if _, err := s.conn.Write(buf.Bytes()); err != nil {
-		logger.Warning("Error occurred while writing data, connection has been dropped.")
-		s.conn = nil
-		router.signals <- signalResetConnection
+}
+
+func (s *catMessageSender) setReady() {
+	s.readyOnce.Do(func() {
+		close(s.ready)
+	})
+}
+
+// waitForTransport waits at most timeout for the first transport, it returns false if there is none yet.
+func (s *catMessageSender) waitForTransport(timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-s.ready:
+		return true
+	case <-timer.C:
+		logger.Warning("No transport has been received after %s.", timeout)
+		return false
+	}
+}
+
+// flush waits until every message queued so far has been written, or ctx is done.
+func (s *catMessageSender) flush(ctx context.Context) error {
+	done := make(chan struct{})
+
+	select {
+	case s.flushes <- done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// flushPending writes the messages queued, and releases the pending flush requests if they all have been.
+// The messages queued meanwhile are left to the next flush. If the connection is dropped meanwhile,
+// the messages not written yet are kept queued for the next one, as the requests are.
+func (s *catMessageSender) flushPending() {
+	for n := len(s.high); n > 0 && s.transport != nil; n-- {
+		s.send(<-s.high)
+	}
+	for n := len(s.normal); n > 0 && s.transport != nil; n-- {
+		s.send(<-s.normal)
+	}
+	for n := len(s.atomic); n > 0 && s.transport != nil; n-- {
+		s.merging = append(s.merging, <-s.atomic)
+	}
+	s.sendMerged()
+
+	if s.transport == nil {
+		// the connection has been dropped, the requests wait for the next one.
 		return
 	}
-	return
+	if f, ok := s.transport.(flusher); ok {
+		if err := f.flush(); err != nil {
+			logger.Warning("Error occurred while flushing data: %s", err)
+		}
+	}
+	s.releasePending()
+}
+
+func (s *catMessageSender) releasePending() {
+	for _, done := range s.pending {
+		close(done)
+	}
+	s.pending = nil
 }
 
 func (s *catMessageSender) handleTransaction(trans *message.Transaction) {
@@ -107,6 +212,15 @@ func (s *catMessageSender) handleTransaction(trans *message.Transaction) {
 	}
 }
 
+// handleAtomicTransaction queues a successful transaction of an atomic type, to be sent merged with others.
+func (s *catMessageSender) handleAtomicTransaction(trans *message.Transaction) {
+	select {
+	case s.atomic <- trans:
+	default:
+		// logger.Warning("Atomic channel is full, transaction has been discarded.")
+	}
+}
+
 func (s *catMessageSender) handleHeartbeat(heartbeat *message.Heartbeat) {
 	select {
 	case s.normal <- heartbeat:
@@ -120,13 +234,21 @@ func (s *catMessageSender) handleEvent(event *message.Event) {
 	case s.normal <- event:
 	default:
 		// logger.Warning("Normal priority channel is full, event has been discarded.")
+		event.Release()
 	}
 }
 
+func (s *catMessageSender) afterStart() {
+	s.merger = time.NewTicker(atomicMergeInterval)
+}
+
 func (s *catMessageSender) beforeStop() {
-	close(s.chConn)
+	s.merger.Stop()
+
+	close(s.chTransport)
 	close(s.high)
 	close(s.normal)
+	close(s.atomic)
 
 	for m := range s.high {
 		s.send(m)
@@ -134,36 +256,93 @@ func (s *catMessageSender) beforeStop() {
 	for m := range s.normal {
 		s.send(m)
 	}
+	for t := range s.atomic {
+		s.merging = append(s.merging, t)
+	}
+	s.sendMerged()
+
+	if s.transport != nil {
+		s.transport.Close()
+	}
+	s.releasePending()
 }
 
 func (s *catMessageSender) process() {
-	if s.conn == nil {
-		s.conn = <-s.chConn
-		logger.Info("Received a new connection: %s", s.conn.RemoteAddr().String())
+	if s.transport == nil {
+		select {
+		case sig := <-s.signals:
+			s.handle(sig)
+		case transport := <-s.chTransport:
+			s.setTransport(transport)
+		case done := <-s.flushes:
+			s.pending = append(s.pending, done)
+		}
 		return
 	}
 
+	var tick <-chan time.Time
+	if s.merger != nil {
+		tick = s.merger.C
+	}
+
 	select {
 	case sig := <-s.signals:
 		s.handle(sig)
-	case conn := <-s.chConn:
-		logger.Info("Received a new connection: %s", conn.RemoteAddr().String())
-		s.conn = conn
+	case transport := <-s.chTransport:
+		s.setTransport(transport)
 	case m := <-s.high:
 		// logger.Debug("Receive a message [%s|%s] from high priority channel", m.GetType(), m.GetName())
 		s.send(m)
 	case m := <-s.normal:
 		// logger.Debug("Receive a message [%s|%s] from normal priority channel", m.GetType(), m.GetName())
 		s.send(m)
+	case t := <-s.atomic:
+		s.merge(t)
+	case <-tick:
+		s.sendMerged()
+	case done := <-s.flushes:
+		s.pending = append(s.pending, done)
+		s.flushPending()
 	}
 }
 
-var sender = catMessageSender{
-	scheduleMixin: makeScheduleMixedIn(signalSenderExit),
-	normal:        make(chan message.Messager, normalPriorityQueueSize),
-	high:          make(chan message.Messager, highPriorityQueueSize),
-	chConn:        make(chan net.Conn),
-	encoder:       message.NewReadableEncoder(),
-	buf:           bytes.NewBuffer([]byte{}),
-	conn:          nil,
+// merge adds t to the transactions to send together, sending them if there are enough.
+func (s *catMessageSender) merge(t *message.Transaction) {
+	s.merging = append(s.merging, t)
+	if len(s.merging) >= atomicMergeCount {
+		s.sendMerged()
+	}
 }
+
+// sendMerged sends the transactions of atomic types merged so far, as the children of a single tree.
+func (s *catMessageSender) sendMerged() {
+	if len(s.merging) == 0 || s.transport == nil {
+		return
+	}
+
+	trans := message.NewTransaction(typeMergeTree, typeMergeTree, nil)
+	trans.SetDurationStart(s.merging[0].GetTime())
+	for _, m := range s.merging {
+		trans.AddChild(m)
+	}
+	trans.Complete()
+	s.merging = s.merging[:0]
+
+	s.send(trans)
+}
+
+func newMessageSender() *catMessageSender {
+	return &catMessageSender{
+		scheduleMixin: makeScheduleMixedIn(signalSenderExit),
+		normal:        make(chan message.Messager, normalPriorityQueueSize),
+		high:          make(chan message.Messager, highPriorityQueueSize),
+		atomic:        make(chan *message.Transaction, normalPriorityQueueSize),
+		chTransport:   make(chan Transport),
+		encoder:       message.NewReadableEncoder(),
+		transport:     nil,
+		flushes:       make(chan chan struct{}),
+		ready:         make(chan struct{}),
+	}
+}
+
+var sender = newMessageSender()
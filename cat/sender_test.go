@@ -0,0 +1,164 @@
+package cat
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xiaobudongzhang/cat-go/message"
+)
+
+type recordingTransport struct {
+	mu      sync.Mutex
+	frames  int
+	flushed int
+	// failAt is the frame the transport fails at, if any.
+	failAt int
+}
+
+func (t *recordingTransport) Send(frame []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.failAt > 0 && t.frames+1 == t.failAt {
+		return errors.New("connection reset")
+	}
+	t.frames++
+	return nil
+}
+
+func (t *recordingTransport) flush() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.flushed = t.frames
+	return nil
+}
+
+func (t *recordingTransport) Close() {}
+
+// runSender runs s until stop is called, without notifying the scheduler.
+func runSender(s *catMessageSender) (stop func()) {
+	s.setAlive(true)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for s.alive() {
+			s.process()
+		}
+	}()
+	return func() {
+		s.signals <- signalShutdown
+		<-done
+	}
+}
+
+func TestSenderFlush(t *testing.T) {
+	s := newMessageSender()
+	stop := runSender(s)
+	defer stop()
+
+	for i := 0; i < 3; i++ {
+		s.handleEvent(message.NewEvent("Test", "event", nil))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.flush(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("the flush should wait for a transport: %v", err)
+	}
+
+	transport := &recordingTransport{}
+	flushed := make(chan error)
+	go func() {
+		flushed <- s.flush(context.Background())
+	}()
+	s.chTransport <- transport
+
+	if err := <-flushed; err != nil {
+		t.Fatal(err)
+	}
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	if transport.frames != 3 || transport.flushed != 3 {
+		t.Errorf("the queued messages should have been written and flushed: %d, %d", transport.frames, transport.flushed)
+	}
+}
+
+func TestSenderWaitForTransport(t *testing.T) {
+	s := newMessageSender()
+	stop := runSender(s)
+	defer stop()
+
+	if s.waitForTransport(10 * time.Millisecond) {
+		t.Fatal("there should be no transport yet")
+	}
+
+	go func() {
+		s.chTransport <- &recordingTransport{}
+	}()
+	if !s.waitForTransport(time.Second) {
+		t.Fatal("the transport should have been received")
+	}
+}
+
+func TestSenderFlushTransportDropped(t *testing.T) {
+	s := newMessageSender()
+	stop := runSender(s)
+	defer stop()
+
+	for i := 0; i < 3; i++ {
+		s.handleEvent(message.NewEvent("Test", "event", nil))
+	}
+
+	flushed := make(chan error, 1)
+	go func() {
+		flushed <- s.flush(context.Background())
+	}()
+	// the second frame drops the connection.
+	s.chTransport <- &recordingTransport{failAt: 2}
+
+	select {
+	case err := <-flushed:
+		t.Fatalf("the flush should wait for the next connection: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if n := len(s.normal); n != 1 {
+		t.Fatalf("the message not written yet should be kept queued: %d", n)
+	}
+
+	transport := &recordingTransport{}
+	s.chTransport <- transport
+	if err := <-flushed; err != nil {
+		t.Fatal(err)
+	}
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	if transport.frames != 1 || transport.flushed != 1 {
+		t.Errorf("the message kept should have been written and flushed: %d, %d", transport.frames, transport.flushed)
+	}
+}
+
+func TestSenderMergeAtomic(t *testing.T) {
+	s := newMessageSender()
+	stop := runSender(s)
+	defer stop()
+
+	transport := &recordingTransport{}
+	s.chTransport <- transport
+
+	for i := 0; i < 3; i++ {
+		trans := message.NewTransaction("Cache.get", "user", nil)
+		trans.Complete()
+		s.handleAtomicTransaction(trans)
+	}
+	if err := s.flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	if transport.frames != 1 {
+		t.Errorf("the atomic transactions should have been sent as a single tree: %d frames", transport.frames)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"go/build"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"strings"
 )
@@ -29,30 +30,110 @@ func trimPath(filename string) string {
 	return filename
 }
 
-func functionName(pc uintptr) string {
-	fn := runtime.FuncForPC(pc)
-	if fn == nil {
-		return "unknown"
+// maxCauses bounds the depth of the error chains written, in case of cycles.
+const maxCauses = 16
+
+// newStacktrace writes err, its stack and the chain of its causes, like Java does:
+//
+//	message
+//	at function(file:line)
+//	Caused by: cause message
+//	at function(file:line)
+//
+// The stack is the one err has been created with if it carries one through a StackTrace method,
+// such as the errors of github.com/pkg/errors, or else the caller's stack, skip frames above.
+func newStacktrace(skip int, err error) (buf *bytes.Buffer) {
+	return formatStacktrace(err, errorOrCallerStack(skip+1, err))
+}
+
+// errorOrCallerStack returns the stack err has been created with, or else the caller's stack, skip frames above.
+func errorOrCallerStack(skip int, err error) []uintptr {
+	if pcs := errorStack(err); pcs != nil {
+		return pcs
 	}
-	return fn.Name()
+	pcs := make([]uintptr, 64)
+	return pcs[:runtime.Callers(skip+1, pcs)]
 }
 
-func newStacktrace(skip int, err error) (buf *bytes.Buffer) {
+func formatStacktrace(err error, pcs []uintptr) (buf *bytes.Buffer) {
 	buf = bytes.NewBuffer([]byte{})
 	buf.WriteString(err.Error())
 	buf.WriteRune('\n')
-	for i := skip; ; i++ {
-		pc, file, line, ok := runtime.Caller(i)
-		if !ok {
-			break
+	writeFrames(buf, pcs)
+	writeCauses(buf, err, 0)
+	return buf
+}
+
+func writeCauses(buf *bytes.Buffer, err error, depth int) {
+	for _, cause := range unwrap(err) {
+		if depth >= maxCauses {
+			buf.WriteString("...\n")
+			return
+		}
+		// wrappers adding a stack only, like pkg/errors' withStack, are skipped.
+		if cause.Error() != err.Error() || errorStack(cause) != nil {
+			buf.WriteString("Caused by: ")
+			buf.WriteString(cause.Error())
+			buf.WriteRune('\n')
+			writeFrames(buf, errorStack(cause))
 		}
-		file = trimPath(file)
-		name := functionName(pc)
+		writeCauses(buf, cause, depth+1)
+	}
+}
+
+func writeFrames(buf *bytes.Buffer, pcs []uintptr) {
+	if len(pcs) == 0 {
+		return
+	}
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
 		// `runtime.goexit` is bootstrap loader and is meaningless in tracing.
-		if name == "runtime.goexit" {
-			continue
+		if frame.Function != "runtime.goexit" && frame.Function != "" {
+			buf.WriteString(fmt.Sprintf("at %s(%s:%d)\n", frame.Function, trimPath(frame.File), frame.Line))
+		}
+		if !more {
+			break
 		}
-		buf.WriteString(fmt.Sprintf("at %s(%s:%d)\n", name, file, line))
 	}
-	return buf
+}
+
+// unwrap returns the causes of err, either wrapped by fmt.Errorf("%w") or joined by errors.Join.
+func unwrap(err error) []error {
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		if cause := e.Unwrap(); cause != nil {
+			return []error{cause}
+		}
+	case interface{ Unwrap() []error }:
+		return e.Unwrap()
+	}
+	return nil
+}
+
+// errorStack returns the program counters err has been created at, if it has a StackTrace method
+// returning a slice of program counters, whatever the named types of the slice and its elements.
+func errorStack(err error) []uintptr {
+	method := reflect.ValueOf(err).MethodByName("StackTrace")
+	if !method.IsValid() || method.Type().NumIn() != 0 || method.Type().NumOut() != 1 {
+		return nil
+	}
+	if out := method.Type().Out(0); out.Kind() != reflect.Slice || out.Elem().Kind() != reflect.Uintptr {
+		return nil
+	}
+
+	stack := method.Call(nil)[0]
+	if stack.Len() == 0 {
+		return nil
+	}
+	pcs := make([]uintptr, stack.Len())
+	for i := range pcs {
+		pcs[i] = uintptr(stack.Index(i).Uint())
+	}
+	return pcs
+}
+
+// errorType returns the name of the concrete type of err, such as errors.errorString.
+func errorType(err error) string {
+	return strings.TrimPrefix(reflect.TypeOf(err).String(), "*")
 }
@@ -0,0 +1,87 @@
+package cat
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// frame and stackTrace mimic the types of github.com/pkg/errors.
+type frame uintptr
+
+type stackTrace []frame
+
+type stackError struct {
+	msg   string
+	stack []uintptr
+}
+
+func (e *stackError) Error() string {
+	return e.msg
+}
+
+func (e *stackError) StackTrace() stackTrace {
+	var frames = make(stackTrace, len(e.stack))
+	for i, pc := range e.stack {
+		frames[i] = frame(pc)
+	}
+	return frames
+}
+
+func newStackError(msg string) error {
+	pcs := make([]uintptr, 32)
+	return &stackError{msg: msg, stack: pcs[:runtime.Callers(1, pcs)]}
+}
+
+func TestStacktraceCallerStack(t *testing.T) {
+	trace := newStacktrace(1, errors.New("boom")).String()
+	if !strings.HasPrefix(trace, "boom\nat github.com/xiaobudongzhang/cat-go/cat.TestStacktraceCallerStack(") {
+		t.Errorf("the stack should start at the caller:\n%s", trace)
+	}
+	if strings.Contains(trace, "runtime.goexit") || strings.Contains(trace, "Caused by") {
+		t.Errorf("unexpected stack:\n%s", trace)
+	}
+}
+
+func TestStacktraceOriginStack(t *testing.T) {
+	err := newStackError("boom")
+	trace := newStacktrace(1, err).String()
+	if !strings.HasPrefix(trace, "boom\nat github.com/xiaobudongzhang/cat-go/cat.newStackError(") {
+		t.Errorf("the stack should be the one of the error:\n%s", trace)
+	}
+}
+
+func TestStacktraceCauses(t *testing.T) {
+	origin := newStackError("connection refused")
+	err := fmt.Errorf("query failed: %w", errors.Join(origin, errors.New("timeout")))
+
+	trace := newStacktrace(1, err).String()
+	if !strings.HasPrefix(trace, err.Error()+"\nat github.com/xiaobudongzhang/cat-go/cat.TestStacktraceCauses(") {
+		t.Errorf("the stack should start with the error and the caller:\n%s", trace)
+	}
+
+	// the joined causes, then each of them, the origin one followed by its own stack.
+	var last = 0
+	for _, expected := range []string{
+		"\nCaused by: connection refused\ntimeout\n",
+		"\nCaused by: connection refused\nat github.com/xiaobudongzhang/cat-go/cat.newStackError(",
+		"\nCaused by: timeout\n",
+	} {
+		i := strings.Index(trace[last:], expected)
+		if i < 0 {
+			t.Fatalf("%q not found in order in:\n%s", expected, trace)
+		}
+		last += i + 1
+	}
+}
+
+func TestErrorType(t *testing.T) {
+	if name := errorType(errors.New("boom")); name != "errors.errorString" {
+		t.Errorf("unexpected name: %s", name)
+	}
+	if name := errorType(newStackError("boom")); name != "cat.stackError" {
+		t.Errorf("unexpected name: %s", name)
+	}
+}
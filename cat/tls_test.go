@@ -0,0 +1,24 @@
+package cat
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildTLSConfig(t *testing.T) {
+	if cfg, err := buildTLSConfig(XMLConfigTLS{}); cfg != nil || err != nil {
+		t.Error("tls should be disabled by default")
+	}
+
+	cfg, err := buildTLSConfig(XMLConfigTLS{Enabled: true, ServerName: "cat.example.com"})
+	if err != nil || cfg == nil || cfg.ServerName != "cat.example.com" {
+		t.Errorf("unexpected tls config: %v, %v", cfg, err)
+	}
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	_ = ioutil.WriteFile(ca, []byte("not a certificate"), 0644)
+	if _, err := buildTLSConfig(XMLConfigTLS{Enabled: true, CAFile: ca}); err == nil {
+		t.Error("an invalid ca bundle should be rejected")
+	}
+}
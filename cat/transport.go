@@ -0,0 +1,278 @@
+package cat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	TransportTcp  = "tcp"
+	TransportFile = "file"
+	TransportHttp = "http"
+)
+
+// Transport delivers encoded messages to the cat server.
+// A frame is a single message encoded with its header, Send is only called from the sender goroutine.
+// The frame is reused once Send has returned, it must be copied to be kept.
+type Transport interface {
+	Send(frame []byte) error
+	Close()
+}
+
+// flusher is implemented by the transports buffering frames, flush writes the frames buffered.
+type flusher interface {
+	flush() error
+}
+
+func newTransport(c XMLConfigTransport) (Transport, error) {
+	switch c.Type {
+	case "", TransportTcp:
+		// tcp connections are established by the router.
+		return nil, nil
+	case TransportFile:
+		return newFileTransport(c.Path)
+	case TransportHttp:
+		return newHttpTransport(c.Url, c.BatchSize)
+	default:
+		return nil, fmt.Errorf("Unknown transport type: %s", c.Type)
+	}
+}
+
+type tcpTransport struct {
+	conn net.Conn
+	// prefix holds the length of the frame being sent, Send being called by the sender goroutine only.
+	prefix [4]byte
+}
+
+func newTcpTransport(conn net.Conn) *tcpTransport {
+	return &tcpTransport{conn: conn}
+}
+
+func (t *tcpTransport) String() string {
+	return "tcp://" + t.conn.RemoteAddr().String()
+}
+
+func (t *tcpTransport) Send(frame []byte) error {
+	var b = t.prefix[:]
+	binary.BigEndian.PutUint32(b, uint32(len(frame)))
+
+	if err := t.conn.SetWriteDeadline(time.Now().Add(time.Second * 3)); err != nil {
+		return err
+	}
+	if _, err := t.conn.Write(b); err != nil {
+		return err
+	}
+	if _, err := t.conn.Write(frame); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (t *tcpTransport) Close() {
+	_ = t.conn.Close()
+}
+
+// fileTransport writes messages in the readable format, it's meant for local debugging.
+type fileTransport struct {
+	w    io.Writer
+	name string
+}
+
+func newFileTransport(path string) (*fileTransport, error) {
+	if path == "" || path == "-" || path == "stdout" {
+		return &fileTransport{w: os.Stdout, name: "stdout"}, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &fileTransport{w: file, name: path}, nil
+}
+
+func (t *fileTransport) String() string {
+	return "file://" + t.name
+}
+
+func (t *fileTransport) Send(frame []byte) error {
+	if _, err := t.w.Write(frame); err != nil {
+		return err
+	}
+	_, err := t.w.Write([]byte{'\n'})
+	return err
+}
+
+func (t *fileTransport) Close() {
+	if file, ok := t.w.(*os.File); ok && file != os.Stdout {
+		_ = file.Close()
+	}
+}
+
+// httpTransport posts frames in batches, each of them prefixed by its length like the tcp protocol does.
+// Batches are posted by a background goroutine once full or every httpTransportFlushInterval, so that a slow
+// collector never stalls the sender. Full batches are dropped while httpTransportQueueSize of them are waiting.
+type httpTransport struct {
+	url       string
+	client    *http.Client
+	batchSize int
+
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	prefix [4]byte
+	count  int
+
+	batches chan httpBatch
+	ticker  *time.Ticker
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// httpBatch is a batch to post, done receiving the result of the post if it is waited for.
+type httpBatch struct {
+	data *bytes.Buffer
+	done chan error
+}
+
+func newHttpTransport(url string, batchSize int) (*httpTransport, error) {
+	if url == "" {
+		return nil, errors.New("Url is required by the http transport")
+	}
+	if batchSize <= 0 {
+		batchSize = httpTransportBatchSize
+	}
+
+	t := &httpTransport{
+		url:       url,
+		client:    newHttpClient(5 * time.Second),
+		batchSize: batchSize,
+		batches:   make(chan httpBatch, httpTransportQueueSize),
+		ticker:    time.NewTicker(httpTransportFlushInterval),
+		done:      make(chan struct{}),
+	}
+
+	t.wg.Add(1)
+	go t.background()
+	return t, nil
+}
+
+func (t *httpTransport) String() string {
+	return t.url
+}
+
+func (t *httpTransport) background() {
+	defer t.wg.Done()
+
+	for {
+		select {
+		case <-t.done:
+			return
+		case batch := <-t.batches:
+			err := t.post(batch.data)
+			putBuffer(batch.data)
+			if batch.done != nil {
+				batch.done <- err
+			} else if err != nil {
+				logger.Warning("Error occurred while posting messages to %s: %s", t.url, err)
+			}
+		case <-t.ticker.C:
+			if data := t.take(); data != nil {
+				if err := t.post(data); err != nil {
+					logger.Warning("Error occurred while posting messages to %s: %s", t.url, err)
+				}
+				putBuffer(data)
+			}
+		}
+	}
+}
+
+func (t *httpTransport) Send(frame []byte) error {
+	t.mu.Lock()
+	var b = t.prefix[:]
+	binary.BigEndian.PutUint32(b, uint32(len(frame)))
+	t.buf.Write(b)
+	t.buf.Write(frame)
+	t.count++
+
+	if t.count < t.batchSize {
+		t.mu.Unlock()
+		return nil
+	}
+	data := t.takeLocked()
+	t.mu.Unlock()
+
+	select {
+	case t.batches <- httpBatch{data: data}:
+		return nil
+	default:
+		putBuffer(data)
+		return fmt.Errorf("%d batches are waiting to be posted, a batch has been dropped", httpTransportQueueSize)
+	}
+}
+
+// take returns the pending batch in a pooled buffer, or nil if there is none.
+func (t *httpTransport) take() *bytes.Buffer {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.takeLocked()
+}
+
+func (t *httpTransport) takeLocked() *bytes.Buffer {
+	if t.count == 0 {
+		return nil
+	}
+	data := getBuffer()
+	data.Write(t.buf.Bytes())
+	t.buf.Reset()
+	t.count = 0
+	return data
+}
+
+// flush posts the pending batch after the batches waiting, and waits for the result.
+func (t *httpTransport) flush() error {
+	done := make(chan error, 1)
+	select {
+	case t.batches <- httpBatch{data: t.take(), done: done}:
+	case <-t.done:
+		return errors.New("Transport has been closed")
+	}
+	return <-done
+}
+
+// post sends a batch, which is dropped even if the request failed.
+func (t *httpTransport) post(data *bytes.Buffer) error {
+	if data == nil || data.Len() == 0 {
+		return nil
+	}
+
+	resp, err := t.client.Post(t.url, "application/octet-stream", bytes.NewReader(data.Bytes()))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Unexpected status: %s", resp.Status)
+	}
+	return nil
+}
+
+func (t *httpTransport) Close() {
+	t.ticker.Stop()
+	if err := t.flush(); err != nil {
+		logger.Warning("Error occurred while posting messages to %s: %s", t.url, err)
+	}
+
+	close(t.done)
+	t.wg.Wait()
+}
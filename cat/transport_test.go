@@ -0,0 +1,101 @@
+package cat
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xiaobudongzhang/cat-go/message"
+)
+
+func TestFileTransport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cat.log")
+	transport, err := newTransport(XMLConfigTransport{Type: TransportFile, Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &catMessageSender{
+		encoder:   message.NewReadableEncoder(),
+		transport: transport,
+		fixed:     true,
+	}
+	s.send(message.NewEvent("foo", "bar", nil))
+	transport.Close()
+
+	data, _ := ioutil.ReadFile(path)
+	if !strings.HasPrefix(string(data), message.ReadableProtocol) || !strings.Contains(string(data), "\tfoo\tbar\t") {
+		t.Errorf("unexpected file content: %q", data)
+	}
+}
+
+func TestHttpTransport(t *testing.T) {
+	var frames [][]byte
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		for len(body) >= 4 {
+			n := binary.BigEndian.Uint32(body)
+			frames = append(frames, body[4:4+n])
+			body = body[4+n:]
+		}
+	}))
+	defer server.Close()
+
+	transport, err := newHttpTransport(server.URL, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, frame := range []string{"a", "bb", "ccc"} {
+		if err := transport.Send([]byte(frame)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the last frame is posted on close.
+	transport.Close()
+
+	if len(frames) != 3 || string(frames[2]) != "ccc" {
+		t.Errorf("unexpected frames: %q", frames)
+	}
+}
+
+func TestHttpTransportStalled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+
+	transport, err := newHttpTransport(server.URL, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	var dropped int
+	for i := 0; i < 2*httpTransportQueueSize; i++ {
+		if err := transport.Send([]byte("a")); err != nil {
+			dropped++
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("a stalled collector should not block the sender: %s", elapsed)
+	}
+	if dropped == 0 {
+		t.Error("batches should be dropped once the queue is full")
+	}
+
+	close(release)
+	transport.Close()
+}
+
+func TestUnknownTransport(t *testing.T) {
+	if _, err := newTransport(XMLConfigTransport{Type: "udp"}); err == nil {
+		t.Error("unknown transport should be rejected")
+	}
+}
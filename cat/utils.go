@@ -1,36 +1,23 @@
 package cat
 
 import (
-	"fmt"
+	"encoding/hex"
 	"net"
 	"time"
 )
 
-func getLocalhostIp() (ip net.IP, err error) {
-	ip = net.IPv4(127, 0, 0, 1)
-
-	addrs, err := net.InterfaceAddrs()
-	if err != nil {
-		return
-	}
-
-	for _, address := range addrs {
-		if ipnet, ok := address.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
-			if ipnet.IP.To4() != nil {
-				ip = ipnet.IP
-				return
-			}
-		}
-	}
-	return
-}
-
+// ip2String formats an IPv4 address, including an IPv4-mapped IPv6 one, in dotted form,
+// and an IPv6 address in its compressed form.
 func ip2String(ip net.IP) string {
-	return fmt.Sprintf("%d.%d.%d.%d", ip[12], ip[13], ip[14], ip[15])
+	return ip.String()
 }
 
+// ip2HexString returns the 8 hex digits of an IPv4 address, or the 32 of an IPv6 address.
 func ip2HexString(ip net.IP) string {
-	return fmt.Sprintf("%02x%02x%02x%02x", ip[12], ip[13], ip[14], ip[15])
+	if ip4 := ip.To4(); ip4 != nil {
+		return hex.EncodeToString(ip4)
+	}
+	return hex.EncodeToString(ip.To16())
 }
 
 func duration2Millis(duration time.Duration) int64 {
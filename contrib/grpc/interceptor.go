@@ -0,0 +1,195 @@
+// Package catgrpc provides grpc interceptors recording calls as cat transactions.
+//
+// Servers record a Service transaction and clients a Call transaction per rpc, named by the full method.
+// Message ids are propagated through the grpc metadata, so that the server's tree is linked to the client's one.
+//
+//	server := grpc.NewServer(
+//		grpc.UnaryInterceptor(catgrpc.UnaryServerInterceptor()),
+//		grpc.StreamInterceptor(catgrpc.StreamServerInterceptor()),
+//	)
+//	conn, err := grpc.Dial(target,
+//		grpc.WithUnaryInterceptor(catgrpc.UnaryClientInterceptor()),
+//		grpc.WithStreamInterceptor(catgrpc.StreamClientInterceptor()),
+//	)
+package catgrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/xiaobudongzhang/cat-go/cat"
+	"github.com/xiaobudongzhang/cat-go/message"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	TypeService = "Service"
+	TypeCall    = "Call"
+
+	MetadataRootMessageId    = "x-cat-root-id"
+	MetadataParentMessageId  = "x-cat-parent-id"
+	MetadataChildMessageId   = "x-cat-id"
+	MetadataClientDomainName = "x-cat-domain"
+)
+
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, t := startServer(ctx, info.FullMethod)
+		resp, err := handler(ctx, req)
+		finish(t, info.FullMethod, err)
+		return resp, err
+	}
+}
+
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, t := startServer(ss.Context(), info.FullMethod)
+		err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		finish(t, info.FullMethod, err)
+		return err
+	}
+}
+
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		var p peer.Peer
+		ctx, t := startClient(ctx, method, cc)
+		err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Peer(&p))...)
+		logPeer(t, TypeCall+".server", &p)
+		finish(t, method, err)
+		return err
+	}
+}
+
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		var p = &peer.Peer{}
+		ctx, t := startClient(ctx, method, cc)
+		s, err := streamer(ctx, desc, cc, method, append(opts, grpc.Peer(p))...)
+		if err != nil {
+			finish(t, method, err)
+			return nil, err
+		}
+		return &clientStream{ClientStream: s, t: t, method: method, peer: p, serverStreams: desc.ServerStreams}, nil
+	}
+}
+
+func startServer(ctx context.Context, method string) (context.Context, message.Transactor) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		ctx = cat.LogRemoteCallServer(ctx, cat.RemoteContext{
+			RootMessageId:    first(md, MetadataRootMessageId),
+			ParentMessageId:  first(md, MetadataParentMessageId),
+			ChildMessageId:   first(md, MetadataChildMessageId),
+			ClientDomainName: first(md, MetadataClientDomainName),
+		})
+	}
+
+	ctx, t := cat.StartTransaction(ctx, TypeService, method)
+	if domain, _ := ctx.Value(cat.CatContextClientDomainName).(string); domain != "" {
+		t.LogEvent(TypeService+".app", domain)
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		logPeer(t, TypeService+".client", p)
+	}
+	return ctx, t
+}
+
+func startClient(ctx context.Context, method string, cc *grpc.ClientConn) (context.Context, message.Transactor) {
+	ctx, t := cat.StartTransaction(ctx, TypeCall, method)
+	t.AddData("target", cc.Target())
+
+	remote := cat.LogRemoteCallClient(ctx)
+	if remote.ChildMessageId != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx,
+			MetadataRootMessageId, remote.RootMessageId,
+			MetadataParentMessageId, remote.ParentMessageId,
+			MetadataChildMessageId, remote.ChildMessageId,
+			MetadataClientDomainName, remote.ClientDomainName,
+		)
+	}
+	return ctx, t
+}
+
+func finish(t message.Transactor, method string, err error) {
+	code := status.Code(err)
+	t.AddData("code", code.String())
+	if code != codes.OK {
+		t.SetStatus(code.String())
+		cat.LogErrorWithCategory(err, method)
+	}
+	t.Complete()
+}
+
+func logPeer(t message.Transactor, mtype string, p *peer.Peer) {
+	if p.Addr != nil {
+		t.LogEvent(mtype, p.Addr.String())
+	}
+}
+
+func first(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// clientStream completes its transaction once the stream has ended, that is when receiving failed or reached io.EOF,
+// or once the response has been received if the server doesn't stream, as RecvMsg isn't called again then.
+type clientStream struct {
+	grpc.ClientStream
+	t             message.Transactor
+	method        string
+	peer          *peer.Peer
+	serverStreams bool
+	once          sync.Once
+}
+
+func (s *clientStream) finish(err error) {
+	s.once.Do(func() {
+		logPeer(s.t, TypeCall+".server", s.peer)
+		finish(s.t, s.method, err)
+	})
+}
+
+func (s *clientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err != nil && !errors.Is(err, io.EOF) {
+		s.finish(err)
+	}
+	return err
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil && !s.serverStreams {
+		s.finish(nil)
+	} else if errors.Is(err, io.EOF) {
+		s.finish(nil)
+	} else if err != nil {
+		s.finish(err)
+	}
+	return err
+}
+
+func (s *clientStream) Header() (metadata.MD, error) {
+	md, err := s.ClientStream.Header()
+	if err != nil {
+		s.finish(err)
+	}
+	return md, err
+}
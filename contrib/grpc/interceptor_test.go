@@ -0,0 +1,219 @@
+package catgrpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xiaobudongzhang/cat-go/cat"
+	"github.com/xiaobudongzhang/cat-go/message"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+var (
+	mu      sync.Mutex
+	flushed = make(map[string]*message.Transaction)
+)
+
+func TestMain(m *testing.M) {
+	dir, _ := os.MkdirTemp("", "catgrpc")
+	cat.InitWithConfig("catgrpc", cat.XMLConfig{
+		BaseLogDir: dir,
+		Transport:  cat.XMLConfigTransport{Type: cat.TransportFile, Path: dir + "/messages.log"},
+	})
+	cat.AddFlushHook(func(m message.Messager) {
+		if t, ok := m.(*message.Transaction); ok && (t.GetType() == TypeService || t.GetType() == TypeCall) {
+			mu.Lock()
+			flushed[t.GetType()] = t
+			mu.Unlock()
+		}
+	})
+
+	code := m.Run()
+	cat.Shutdown()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// collectServiceDesc describes a client streaming method, counting the requests it receives.
+var collectServiceDesc = grpc.ServiceDesc{
+	ServiceName: "catgrpc.Test",
+	HandlerType: (*interface{})(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Collect",
+		ClientStreams: true,
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			var count int
+			for {
+				var req healthpb.HealthCheckRequest
+				if err := stream.RecvMsg(&req); err == io.EOF {
+					break
+				} else if err != nil {
+					return err
+				}
+				count++
+			}
+			return stream.SendMsg(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_ServingStatus(count)})
+		},
+	}},
+}
+
+func dial(t *testing.T) *grpc.ClientConn {
+	listener := bufconn.Listen(1024 * 1024)
+
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor()),
+		grpc.StreamInterceptor(StreamServerInterceptor()),
+	)
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("foo", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+	server.RegisterService(&collectServiceDesc, nil)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(StreamClientInterceptor()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	mu.Lock()
+	flushed = make(map[string]*message.Transaction)
+	mu.Unlock()
+
+	return conn
+}
+
+func waitFlushed(t *testing.T) (call, service *message.Transaction) {
+	for i := 0; i < 100; i++ {
+		mu.Lock()
+		call, service = flushed[TypeCall], flushed[TypeService]
+		mu.Unlock()
+		if call != nil && service != nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("transactions have not been flushed")
+	return
+}
+
+func remoteCallId(t *testing.T, call *message.Transaction) string {
+	for _, child := range call.GetChildren() {
+		if child.GetType() == "RemoteCall" {
+			return child.GetData().String()
+		}
+	}
+	t.Fatal("RemoteCall event not found")
+	return ""
+}
+
+func TestUnaryInterceptors(t *testing.T) {
+	client := healthpb.NewHealthClient(dial(t))
+
+	if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "foo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	call, service := waitFlushed(t)
+	if call.GetName() != healthpb.Health_Check_FullMethodName || call.GetStatus() != cat.SUCCESS {
+		t.Errorf("unexpected call transaction: %s %s", call.GetName(), call.GetStatus())
+	}
+
+	childId, _ := service.GetCtx().Value(cat.CatContextChildMessageId).(string)
+	if childId == "" || childId != remoteCallId(t, call) {
+		t.Errorf("service message id %q should be the one allocated by the client", childId)
+	}
+}
+
+func TestUnaryInterceptorsFailure(t *testing.T) {
+	client := healthpb.NewHealthClient(dial(t))
+
+	_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "bar"})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	call, service := waitFlushed(t)
+	if call.GetStatus() != codes.NotFound.String() || service.GetStatus() != codes.NotFound.String() {
+		t.Errorf("unexpected status: %s, %s", call.GetStatus(), service.GetStatus())
+	}
+}
+
+func TestStreamInterceptors(t *testing.T) {
+	client := healthpb.NewHealthClient(dial(t))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err := stream.Recv(); status.Code(err) != codes.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	call, service := waitFlushed(t)
+	if call.GetName() != healthpb.Health_Watch_FullMethodName || call.GetStatus() != codes.Canceled.String() {
+		t.Errorf("unexpected call transaction: %s %s", call.GetName(), call.GetStatus())
+	}
+	childId, _ := service.GetCtx().Value(cat.CatContextChildMessageId).(string)
+	if childId != remoteCallId(t, call) {
+		t.Errorf("service message id %q should be the one allocated by the client", childId)
+	}
+}
+
+func TestClientStreamInterceptors(t *testing.T) {
+	conn := dial(t)
+
+	stream, err := conn.NewStream(context.Background(), &collectServiceDesc.Streams[0], "/catgrpc.Test/Collect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := stream.SendMsg(&healthpb.HealthCheckRequest{Service: "foo"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	var resp healthpb.HealthCheckResponse
+	if err := stream.RecvMsg(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != 2 {
+		t.Errorf("%d requests have been received, 2 expected", resp.Status)
+	}
+
+	// RecvMsg isn't called again, as with the generated CloseAndRecv.
+	call, _ := waitFlushed(t)
+	if call.GetName() != "/catgrpc.Test/Collect" || call.GetStatus() != cat.SUCCESS {
+		t.Errorf("unexpected call transaction: %s %s", call.GetName(), call.GetStatus())
+	}
+}
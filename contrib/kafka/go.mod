@@ -0,0 +1,21 @@
+module github.com/xiaobudongzhang/cat-go/contrib/kafka
+
+go 1.24.0
+
+require (
+	github.com/segmentio/kafka-go v0.4.51
+	github.com/xiaobudongzhang/cat-go v0.0.0
+)
+
+require (
+	github.com/go-ole/go-ole v1.2.6 // indirect
+	github.com/klauspost/compress v1.15.9 // indirect
+	github.com/pierrec/lz4/v4 v4.1.15 // indirect
+	github.com/shirou/gopsutil v3.21.11+incompatible // indirect
+	github.com/tklauser/go-sysconf v0.3.11 // indirect
+	github.com/tklauser/numcpus v0.6.0 // indirect
+	github.com/yusufpapurcu/wmi v1.2.3 // indirect
+	golang.org/x/sys v0.9.0 // indirect
+)
+
+replace github.com/xiaobudongzhang/cat-go => ../..
@@ -0,0 +1,125 @@
+// Package catkafka records kafka-go produced and consumed messages as cat transactions.
+//
+//	w := catkafka.NewWriter(&kafka.Writer{Addr: kafka.TCP(broker), Topic: "orders"})
+//	err := w.WriteMessages(ctx, kafka.Message{Value: payload})
+//
+//	msg, err := r.FetchMessage(ctx)
+//	ctx, t := catkafka.StartConsume(ctx, msg)
+//	// handle msg
+//	t.Complete()
+//
+// Produced messages carry the message ids of the producer's tree in their headers. Consumers start forked
+// trees from them: each consumer tree gets its own message id and is linked to the producer's tree as parent,
+// since the same message may be consumed many times, by many groups.
+package catkafka
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/xiaobudongzhang/cat-go/cat"
+	"github.com/xiaobudongzhang/cat-go/message"
+)
+
+const (
+	TypeProduce = "MQ.produce"
+	TypeConsume = "MQ.consume"
+
+	HeaderRootMessageId    = "x-cat-root-id"
+	HeaderParentMessageId  = "x-cat-parent-id"
+	HeaderClientDomainName = "x-cat-domain"
+)
+
+// Writer is a kafka.Writer recording the written messages as a MQ.produce transaction.
+type Writer struct {
+	*kafka.Writer
+}
+
+func NewWriter(w *kafka.Writer) *Writer {
+	return &Writer{Writer: w}
+}
+
+// WriteMessages writes msgs in a MQ.produce transaction named by the topic, nested in the current transaction of ctx
+// if there is one. The message ids are injected in the headers of msgs.
+func (w *Writer) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	ctx, t := cat.StartTransaction(ctx, TypeProduce, w.topic(msgs))
+	t.LogEvent(TypeProduce+".count", strconv.Itoa(len(msgs)))
+	for i := range msgs {
+		Inject(ctx, &msgs[i])
+	}
+
+	err := w.Writer.WriteMessages(ctx, msgs...)
+	if err != nil {
+		t.SetStatus(cat.FAIL)
+		t.AddData("error", err.Error())
+	}
+	t.Complete()
+	return err
+}
+
+func (w *Writer) topic(msgs []kafka.Message) string {
+	if w.Topic != "" {
+		return w.Topic
+	}
+	if len(msgs) > 0 {
+		return msgs[0].Topic
+	}
+	return "unknown"
+}
+
+// Inject sets the headers linking the trees of the consumers of msg to the current tree of ctx.
+func Inject(ctx context.Context, msg *kafka.Message) {
+	remote := cat.LogForkedCall(ctx)
+	if remote.ParentMessageId == "" {
+		return
+	}
+	msg.Headers = setHeader(msg.Headers, HeaderRootMessageId, remote.RootMessageId)
+	msg.Headers = setHeader(msg.Headers, HeaderParentMessageId, remote.ParentMessageId)
+	msg.Headers = setHeader(msg.Headers, HeaderClientDomainName, remote.ClientDomainName)
+}
+
+// Extract returns a context which the next message tree started from is forked from the producer's tree of msg.
+func Extract(ctx context.Context, msg kafka.Message) context.Context {
+	return cat.LogRemoteCallServer(ctx, cat.RemoteContext{
+		RootMessageId:    header(msg.Headers, HeaderRootMessageId),
+		ParentMessageId:  header(msg.Headers, HeaderParentMessageId),
+		ClientDomainName: header(msg.Headers, HeaderClientDomainName),
+	})
+}
+
+// StartConsume starts a MQ.consume transaction named by the topic of msg, forked from the producer's tree.
+// The transaction is nested in the current transaction of ctx instead if there is one.
+func StartConsume(ctx context.Context, msg kafka.Message) (context.Context, message.Transactor) {
+	if cat.TransactionFromContext(ctx) == nil {
+		ctx = Extract(ctx, msg)
+	}
+
+	ctx, t := cat.StartTransaction(ctx, TypeConsume, msg.Topic)
+	if domain := header(msg.Headers, HeaderClientDomainName); domain != "" {
+		t.LogEvent(TypeConsume+".app", domain)
+	}
+	t.AddData("partition", strconv.Itoa(msg.Partition))
+	t.AddData("offset", strconv.FormatInt(msg.Offset, 10))
+	return ctx, t
+}
+
+func header(headers []kafka.Header, key string) string {
+	for _, h := range headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// setHeader replaces the header of a message written again, rather than appending another one.
+func setHeader(headers []kafka.Header, key, value string) []kafka.Header {
+	for i := range headers {
+		if headers[i].Key == key {
+			headers[i].Value = []byte(value)
+			return headers
+		}
+	}
+	return append(headers, kafka.Header{Key: key, Value: []byte(value)})
+}
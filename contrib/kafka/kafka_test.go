@@ -0,0 +1,140 @@
+package catkafka
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/xiaobudongzhang/cat-go/cat"
+	"github.com/xiaobudongzhang/cat-go/message"
+)
+
+var (
+	mu      sync.Mutex
+	flushed []*message.Transaction
+)
+
+func TestMain(m *testing.M) {
+	dir, _ := os.MkdirTemp("", "catkafka")
+	cat.InitWithConfig("catkafka", cat.XMLConfig{
+		BaseLogDir: dir,
+		Transport:  cat.XMLConfigTransport{Type: cat.TransportFile, Path: dir + "/messages.log"},
+	})
+	cat.AddFlushHook(func(m message.Messager) {
+		if t, ok := m.(*message.Transaction); ok && t.GetType() != "System" {
+			mu.Lock()
+			flushed = append(flushed, t)
+			mu.Unlock()
+		}
+	})
+
+	code := m.Run()
+	cat.Shutdown()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func reset() {
+	mu.Lock()
+	flushed = nil
+	mu.Unlock()
+}
+
+func messageId(t message.Messager) string {
+	id, _ := t.GetCtx().Value(cat.CatContextChildMessageId).(string)
+	return id
+}
+
+func TestInjectExtract(t *testing.T) {
+	reset()
+
+	ctx, producer := cat.StartTransaction(context.Background(), "URL", "/orders")
+	msg := kafka.Message{Topic: "orders", Partition: 1, Offset: 42}
+	Inject(ctx, &msg)
+	Inject(ctx, &msg)
+	producer.Complete()
+
+	if len(msg.Headers) != 3 {
+		t.Fatalf("headers should be set once: %+v", msg.Headers)
+	}
+
+	// two consumer groups.
+	_, first := StartConsume(context.Background(), msg)
+	first.Complete()
+	_, second := StartConsume(context.Background(), msg)
+	second.Complete()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(flushed) != 3 {
+		t.Fatalf("expected 3 transactions, got %d", len(flushed))
+	}
+	producerId := messageId(producer)
+	for _, consumer := range []message.Messager{first, second} {
+		if consumer.GetType() != TypeConsume || consumer.GetName() != "orders" {
+			t.Errorf("unexpected consumer transaction: %s %s", consumer.GetType(), consumer.GetName())
+		}
+		if parent, _ := consumer.GetCtx().Value(cat.CatContextParentMessageId).(string); parent != producerId {
+			t.Errorf("consumer parent %q should be the producer %q", parent, producerId)
+		}
+		if root, _ := consumer.GetCtx().Value(cat.CatContextRootMessageId).(string); root != producerId {
+			t.Errorf("consumer root %q should be the producer %q", root, producerId)
+		}
+	}
+	if id := messageId(first); id == "" || id == producerId || id == messageId(second) {
+		t.Errorf("forked trees should have their own message ids: %q, %q", id, messageId(second))
+	}
+}
+
+func TestStartConsumeNested(t *testing.T) {
+	reset()
+
+	ctx, batch := cat.StartTransaction(context.Background(), "Job", "batch")
+	_, consumer := StartConsume(ctx, kafka.Message{Topic: "orders"})
+	consumer.Complete()
+	batch.Complete()
+
+	children := batch.(*message.Transaction).GetChildren()
+	if len(children) != 1 || children[0] != consumer {
+		t.Error("the consumer transaction should be nested in the current transaction")
+	}
+}
+
+func TestWriteMessagesFailure(t *testing.T) {
+	reset()
+
+	w := NewWriter(&kafka.Writer{
+		Addr:         kafka.TCP("127.0.0.1:1"),
+		Topic:        "orders",
+		MaxAttempts:  1,
+		WriteTimeout: time.Second,
+	})
+	defer func() {
+		_ = w.Close()
+	}()
+
+	ctx, root := cat.StartTransaction(context.Background(), "URL", "/orders")
+	msgs := []kafka.Message{{Value: []byte("a")}, {Value: []byte("b")}}
+	if err := w.WriteMessages(ctx, msgs...); err == nil {
+		t.Fatal("writing to a closed port should fail")
+	}
+	root.Complete()
+
+	children := root.(*message.Transaction).GetChildren()
+	if len(children) != 1 {
+		t.Fatalf("expected 1 child, got %d", len(children))
+	}
+	produce := children[0]
+	if produce.GetType() != TypeProduce || produce.GetName() != "orders" || produce.GetStatus() != cat.FAIL {
+		t.Errorf("unexpected produce transaction: %s %s %s", produce.GetType(), produce.GetName(), produce.GetStatus())
+	}
+	for _, msg := range msgs {
+		if header(msg.Headers, HeaderParentMessageId) != messageId(root) {
+			t.Errorf("message ids should have been injected: %+v", msg.Headers)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package catotel
+
+import (
+	"context"
+
+	"github.com/xiaobudongzhang/cat-go/cat"
+	"github.com/xiaobudongzhang/cat-go/message"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	nameAttribute   = attribute.Key("cat.name")
+	statusAttribute = attribute.Key("cat.status")
+	dataAttribute   = attribute.Key("cat.data")
+)
+
+// NewFlushHook returns a hook which emits every flushed CAT transaction tree as spans of tp.
+// Nested transactions become child spans and events become span events.
+//
+//	cat.AddFlushHook(catotel.NewFlushHook(tp))
+func NewFlushHook(tp trace.TracerProvider) cat.FlushHook {
+	tracer := tp.Tracer(tracerName)
+
+	return func(m message.Messager) {
+		t, ok := m.(*message.Transaction)
+		if !ok || t.GetType() == "System" {
+			return
+		}
+		emit(context.Background(), tracer, t)
+	}
+}
+
+// NewOTLPFlushHook is like NewFlushHook, spans are exported over OTLP/HTTP to a collector listening on endpoint,
+// "localhost:4318" for example. The returned provider should be shut down on exit to flush pending spans.
+func NewOTLPFlushHook(ctx context.Context, endpoint string) (cat.FlushHook, *sdktrace.TracerProvider, error) {
+	exporter, err := otlptracehttp.New(ctx,
+		otlptracehttp.WithEndpoint(endpoint),
+		otlptracehttp.WithInsecure(),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+	return NewFlushHook(tp), tp, nil
+}
+
+func emit(ctx context.Context, tracer trace.Tracer, t *message.Transaction) {
+	ctx, span := tracer.Start(ctx, t.GetName(),
+		trace.WithTimestamp(t.GetTime()),
+		trace.WithSpanKind(spanKind(t.GetType())),
+		trace.WithAttributes(
+			TypeAttribute.String(t.GetType()),
+			nameAttribute.String(t.GetName()),
+		),
+	)
+
+	if data := t.GetData(); data != nil && data.Len() > 0 {
+		span.SetAttributes(dataAttribute.String(data.String()))
+	}
+	if t.GetStatus() != cat.SUCCESS {
+		span.SetStatus(codes.Error, t.GetStatus())
+	}
+
+	for _, child := range t.GetChildren() {
+		switch m := child.(type) {
+		case *message.Transaction:
+			emit(ctx, tracer, m)
+		default:
+			attributes := []attribute.KeyValue{
+				TypeAttribute.String(m.GetType()),
+				nameAttribute.String(m.GetName()),
+				statusAttribute.String(m.GetStatus()),
+			}
+			if data := m.GetData(); data != nil && data.Len() > 0 {
+				attributes = append(attributes, dataAttribute.String(data.String()))
+			}
+			span.AddEvent(m.GetType()+" "+m.GetName(),
+				trace.WithTimestamp(m.GetTime()),
+				trace.WithAttributes(attributes...),
+			)
+		}
+	}
+
+	span.End(trace.WithTimestamp(t.GetTime().Add(t.GetDuration())))
+}
+
+func spanKind(mtype string) trace.SpanKind {
+	switch mtype {
+	case "URL", "Service":
+		return trace.SpanKindServer
+	case "Call", "SQL", "Cache.redis", "Cache.memcached":
+		return trace.SpanKindClient
+	case "MQ.produce":
+		return trace.SpanKindProducer
+	case "MQ.consume":
+		return trace.SpanKindConsumer
+	default:
+		return trace.SpanKindInternal
+	}
+}
@@ -0,0 +1,115 @@
+package catotel
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xiaobudongzhang/cat-go/cat"
+	"github.com/xiaobudongzhang/cat-go/message"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	mu      sync.Mutex
+	flushed []*message.Transaction
+)
+
+func TestMain(m *testing.M) {
+	dir, _ := os.MkdirTemp("", "catotel")
+	cat.InitWithConfig("catotel", cat.XMLConfig{
+		BaseLogDir: dir,
+		Transport:  cat.XMLConfigTransport{Type: cat.TransportFile, Path: dir + "/messages.log"},
+	})
+	cat.AddFlushHook(func(m message.Messager) {
+		if t, ok := m.(*message.Transaction); ok && t.GetType() != "System" {
+			mu.Lock()
+			flushed = append(flushed, t)
+			mu.Unlock()
+		}
+	})
+
+	code := m.Run()
+	cat.Shutdown()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestSpanProcessor(t *testing.T) {
+	mu.Lock()
+	flushed = nil
+	mu.Unlock()
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(NewSpanProcessor()))
+	tracer := tp.Tracer("test")
+
+	ctx, root := tracer.Start(context.Background(), "/foo",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attribute.String("http.method", "GET")),
+	)
+	_, child := tracer.Start(ctx, "query", trace.WithAttributes(TypeAttribute.String("SQL")))
+	child.RecordError(errors.New("timeout"))
+	child.SetStatus(codes.Error, "timeout")
+	child.End()
+	root.End()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(flushed) != 1 {
+		t.Fatalf("expected 1 transaction, got %d", len(flushed))
+	}
+	trans := flushed[0]
+	if trans.GetType() != "URL" || trans.GetName() != "/foo" || trans.GetStatus() != cat.SUCCESS {
+		t.Errorf("unexpected root transaction: %s %s %s", trans.GetType(), trans.GetName(), trans.GetStatus())
+	}
+
+	children := trans.GetChildren()
+	if len(children) != 1 {
+		t.Fatalf("expected 1 child, got %d", len(children))
+	}
+	sql, ok := children[0].(*message.Transaction)
+	if !ok || sql.GetType() != "SQL" || sql.GetStatus() != "timeout" {
+		t.Fatalf("unexpected child: %+v", children[0])
+	}
+	if events := sql.GetChildren(); len(events) != 1 || events[0].GetType() != "Error" {
+		t.Errorf("the recorded error should become an Error event: %+v", events)
+	}
+}
+
+func TestFlushHook(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	root := message.NewTransaction("URL", "/bar", nil)
+	root.SetStatus("fail")
+	root.LogEvent("foo", "bar")
+	child := message.NewTransaction("Call", "remote", nil)
+	child.SetDuration(time.Millisecond)
+	child.Complete()
+	root.AddChild(child)
+	root.SetDuration(time.Second)
+	root.Complete()
+
+	NewFlushHook(tp)(root)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	// children end first.
+	call, url := spans[0], spans[1]
+	if call.Parent.SpanID() != url.SpanContext.SpanID() || call.SpanKind != trace.SpanKindClient {
+		t.Errorf("unexpected child span: %+v", call)
+	}
+	if url.Status.Code != codes.Error || len(url.Events) != 1 || url.EndTime.Sub(url.StartTime) != time.Second {
+		t.Errorf("unexpected root span: %+v", url)
+	}
+}
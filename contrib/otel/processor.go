@@ -0,0 +1,246 @@
+// Package catotel bridges OpenTelemetry and CAT.
+//
+// SpanProcessor turns finished OpenTelemetry spans into CAT transaction trees,
+// NewFlushHook does the reverse and emits CAT transactions as OpenTelemetry spans.
+// Do not feed the spans emitted by the hook back to the processor, spans of the hook's tracer are ignored anyway.
+package catotel
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xiaobudongzhang/cat-go/cat"
+	"github.com/xiaobudongzhang/cat-go/message"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// TypeAttribute overrides the CAT type of the transaction a span is turned into.
+	TypeAttribute = attribute.Key("cat.type")
+
+	tracerName = "github.com/xiaobudongzhang/cat-go/contrib/otel"
+
+	pendingTimeout = time.Minute
+	sweepInterval  = time.Second * 10
+	maxRootIds     = 10000
+)
+
+type pendingTrace struct {
+	// children of the spans which have not ended yet, grouped by their parent span id.
+	children map[trace.SpanID][]sdktrace.ReadOnlySpan
+	updated  time.Time
+}
+
+// SpanProcessor builds a CAT transaction tree for every local root span, that is a span without a parent
+// or with a remote one. Spans are kept until their local root ends, spans which are still pending after a
+// minute are dropped.
+//
+// It implements both sdktrace.SpanProcessor and sdktrace.SpanExporter.
+type SpanProcessor struct {
+	mu        sync.Mutex
+	pending   map[trace.TraceID]*pendingTrace
+	rootIds   map[trace.TraceID]string
+	lastSweep time.Time
+}
+
+var (
+	_ sdktrace.SpanProcessor = (*SpanProcessor)(nil)
+	_ sdktrace.SpanExporter  = (*SpanProcessor)(nil)
+)
+
+func NewSpanProcessor() *SpanProcessor {
+	return &SpanProcessor{
+		pending:   make(map[trace.TraceID]*pendingTrace),
+		rootIds:   make(map[trace.TraceID]string),
+		lastSweep: time.Now(),
+	}
+}
+
+func (p *SpanProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+}
+
+func (p *SpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if s.InstrumentationScope().Name == tracerName {
+		return
+	}
+
+	p.mu.Lock()
+	now := time.Now()
+	if now.Sub(p.lastSweep) > sweepInterval {
+		p.sweep(now)
+	}
+
+	traceId := s.SpanContext().TraceID()
+	parent := s.Parent()
+
+	if parent.IsValid() && !parent.IsRemote() {
+		pending, ok := p.pending[traceId]
+		if !ok {
+			pending = &pendingTrace{children: make(map[trace.SpanID][]sdktrace.ReadOnlySpan)}
+			p.pending[traceId] = pending
+		}
+		pending.children[parent.SpanID()] = append(pending.children[parent.SpanID()], s)
+		pending.updated = now
+		p.mu.Unlock()
+		return
+	}
+
+	var children map[trace.SpanID][]sdktrace.ReadOnlySpan
+	if pending, ok := p.pending[traceId]; ok {
+		children = pending.children
+		delete(p.pending, traceId)
+	}
+	ctx := p.rootContext(traceId)
+	p.mu.Unlock()
+
+	p.flush(ctx, s, children)
+}
+
+func (p *SpanProcessor) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	for _, s := range spans {
+		p.OnEnd(s)
+	}
+	return nil
+}
+
+func (p *SpanProcessor) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func (p *SpanProcessor) ForceFlush(ctx context.Context) error {
+	return nil
+}
+
+func (p *SpanProcessor) sweep(now time.Time) {
+	p.lastSweep = now
+	for traceId, pending := range p.pending {
+		if now.Sub(pending.updated) > pendingTimeout {
+			delete(p.pending, traceId)
+		}
+	}
+}
+
+// rootContext links every local root of a trace to the first one, which keeps the message id it is given here.
+func (p *SpanProcessor) rootContext(traceId trace.TraceID) context.Context {
+	ctx := context.Background()
+	if rootId, ok := p.rootIds[traceId]; ok {
+		return context.WithValue(ctx, cat.CatContextRootMessageId, rootId)
+	}
+
+	if len(p.rootIds) >= maxRootIds {
+		p.rootIds = make(map[trace.TraceID]string)
+	}
+	messageId := cat.Manager.NextId()
+	p.rootIds[traceId] = messageId
+	return context.WithValue(ctx, cat.CatContextChildMessageId, messageId)
+}
+
+func (p *SpanProcessor) flush(ctx context.Context, s sdktrace.ReadOnlySpan, children map[trace.SpanID][]sdktrace.ReadOnlySpan) {
+	if !cat.IsEnabled() {
+		return
+	}
+
+	t, ok := cat.NewTransactionWithContext(ctx, spanType(s), s.Name()).(*message.Transaction)
+	if !ok {
+		return
+	}
+	t.AddData("traceId", s.SpanContext().TraceID().String())
+	fill(t, s, children)
+	t.Complete()
+}
+
+func fill(t *message.Transaction, s sdktrace.ReadOnlySpan, children map[trace.SpanID][]sdktrace.ReadOnlySpan) {
+	t.SetTime(s.StartTime())
+	t.SetDuration(s.EndTime().Sub(s.StartTime()))
+
+	for _, kv := range s.Attributes() {
+		if kv.Key != TypeAttribute {
+			t.AddData(string(kv.Key), kv.Value.Emit())
+		}
+	}
+
+	if s.Status().Code == codes.Error {
+		if s.Status().Description != "" {
+			t.SetStatus(s.Status().Description)
+		} else {
+			t.SetStatus(cat.ERROR)
+		}
+	}
+
+	for _, e := range s.Events() {
+		t.AddChild(newEvent(e))
+	}
+
+	spans := children[s.SpanContext().SpanID()]
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].StartTime().Before(spans[j].StartTime())
+	})
+	for _, child := range spans {
+		ct := message.NewTransaction(spanType(child), child.Name(), nil)
+		fill(ct, child, children)
+		ct.Complete()
+		t.AddChild(ct)
+	}
+}
+
+func newEvent(e sdktrace.Event) *message.Event {
+	var event *message.Event
+
+	if e.Name == "exception" {
+		var mtype, msg, stacktrace string
+		for _, kv := range e.Attributes {
+			switch kv.Key {
+			case "exception.type":
+				mtype = kv.Value.Emit()
+			case "exception.message":
+				msg = kv.Value.Emit()
+			case "exception.stacktrace":
+				stacktrace = kv.Value.Emit()
+			}
+		}
+		event = message.NewEvent("Error", mtype, nil)
+		event.SetStatus(cat.ERROR)
+		event.SetData(msg + "\n" + stacktrace)
+	} else {
+		event = message.NewEvent("Span.Event", e.Name, nil)
+		for _, kv := range e.Attributes {
+			event.AddData(string(kv.Key), kv.Value.Emit())
+		}
+	}
+
+	event.SetTime(e.Time)
+	return event
+}
+
+func spanType(s sdktrace.ReadOnlySpan) string {
+	var isHttp bool
+	for _, kv := range s.Attributes() {
+		switch kv.Key {
+		case TypeAttribute:
+			return kv.Value.Emit()
+		case "http.method", "http.request.method":
+			isHttp = true
+		}
+	}
+
+	switch s.SpanKind() {
+	case trace.SpanKindServer:
+		if isHttp {
+			return "URL"
+		}
+		return "Service"
+	case trace.SpanKindClient:
+		return "Call"
+	case trace.SpanKindProducer:
+		return "MQ.produce"
+	case trace.SpanKindConsumer:
+		return "MQ.consume"
+	default:
+		return "Span"
+	}
+}
@@ -0,0 +1,85 @@
+// Package catredis records go-redis commands as cat transactions.
+//
+//	client := redis.NewClient(opts)
+//	client.AddHook(catredis.NewHook(opts.Addr))
+//
+// Each command is recorded as a Cache.redis transaction named by the command, nested in the current
+// transaction of the command's context if there is one. A pipeline is recorded as a single transaction
+// with an event per command.
+package catredis
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/xiaobudongzhang/cat-go/cat"
+	"github.com/xiaobudongzhang/cat-go/message"
+)
+
+const (
+	TypeRedis = "Cache.redis"
+
+	typeServer  = TypeRedis + ".server"
+	typeCommand = TypeRedis + ".command"
+
+	namePipeline = "pipeline"
+)
+
+type hook struct {
+	addr string
+}
+
+// NewHook returns a hook recording the commands sent to the server listening on addr.
+func NewHook(addr string) redis.Hook {
+	return &hook{addr: addr}
+}
+
+func (h *hook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h *hook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		ctx, t := cat.StartTransaction(ctx, TypeRedis, cmd.Name())
+		t.LogEvent(typeServer, h.addr)
+
+		err := next(ctx, cmd)
+		finish(t, err)
+		return err
+	}
+}
+
+func (h *hook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		ctx, t := cat.StartTransaction(ctx, TypeRedis, namePipeline)
+		t.LogEvent(typeServer, h.addr)
+
+		err := next(ctx, cmds)
+		for _, cmd := range cmds {
+			if failed(cmd.Err()) {
+				t.LogEvent(typeCommand, cmd.Name(), cat.FAIL, cmd.Err().Error())
+			} else {
+				t.LogEvent(typeCommand, cmd.Name())
+			}
+		}
+		finish(t, err)
+		return err
+	}
+}
+
+// failed tells if err is a failure, a missing key isn't.
+func failed(err error) bool {
+	return err != nil && !errors.Is(err, redis.Nil)
+}
+
+func finish(t message.Transactor, err error) {
+	if failed(err) {
+		t.SetStatus(cat.FAIL)
+		t.AddData("error", err.Error())
+	}
+	t.Complete()
+}
@@ -0,0 +1,125 @@
+package catredis
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/xiaobudongzhang/cat-go/cat"
+	"github.com/xiaobudongzhang/cat-go/message"
+)
+
+var (
+	mu      sync.Mutex
+	flushed []*message.Transaction
+)
+
+func TestMain(m *testing.M) {
+	dir, _ := os.MkdirTemp("", "catredis")
+	cat.InitWithConfig("catredis", cat.XMLConfig{
+		BaseLogDir: dir,
+		Transport:  cat.XMLConfigTransport{Type: cat.TransportFile, Path: dir + "/messages.log"},
+	})
+	cat.AddFlushHook(func(m message.Messager) {
+		if t, ok := m.(*message.Transaction); ok && t.GetType() != "System" {
+			mu.Lock()
+			flushed = append(flushed, t)
+			mu.Unlock()
+		}
+	})
+
+	code := m.Run()
+	cat.Shutdown()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func newClient(t *testing.T) *redis.Client {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	client.AddHook(NewHook(server.Addr()))
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+
+	mu.Lock()
+	flushed = nil
+	mu.Unlock()
+	return client
+}
+
+// children returns the children of t having mtype, ignoring the commands sent by go-redis to initialize connections.
+func children(t message.Messager, mtype string) []message.Messager {
+	var messages []message.Messager
+	for _, child := range t.(*message.Transaction).GetChildren() {
+		if child.GetType() == mtype {
+			if _, ok := child.(*message.Transaction); ok && child.GetName() == namePipeline {
+				continue
+			}
+			messages = append(messages, child)
+		}
+	}
+	return messages
+}
+
+func TestProcessHook(t *testing.T) {
+	client := newClient(t)
+
+	ctx, root := cat.StartTransaction(context.Background(), "URL", "/foo")
+	if err := client.Set(ctx, "k", "v", 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Get(ctx, "missing").Err(); err != redis.Nil {
+		t.Fatal(err)
+	}
+	root.Complete()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(flushed) != 1 || flushed[0] != root {
+		t.Fatalf("redis transactions should be nested in the current transaction, %d flushed", len(flushed))
+	}
+	commands := children(root, TypeRedis)
+	if len(commands) != 2 {
+		t.Fatalf("expected 2 children, got %d", len(commands))
+	}
+	for i, name := range []string{"set", "get"} {
+		if commands[i].GetType() != TypeRedis || commands[i].GetName() != name || commands[i].GetStatus() != cat.SUCCESS {
+			t.Errorf("unexpected command transaction: %s %s %s", commands[i].GetType(), commands[i].GetName(), commands[i].GetStatus())
+		}
+		if events := children(commands[i], typeServer); len(events) != 1 {
+			t.Errorf("the server address should be logged: %+v", events)
+		}
+	}
+}
+
+func TestProcessPipelineHook(t *testing.T) {
+	client := newClient(t)
+
+	pipe := client.Pipeline()
+	pipe.Set(context.Background(), "k", "v", 0)
+	pipe.Incr(context.Background(), "k")
+	if _, err := pipe.Exec(context.Background()); err == nil {
+		t.Fatal("incr should have failed on a string value")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(flushed) != 1 {
+		t.Fatalf("expected 1 transaction, got %d", len(flushed))
+	}
+	pipeline := flushed[0]
+	if pipeline.GetName() != namePipeline || pipeline.GetStatus() != cat.FAIL {
+		t.Errorf("unexpected pipeline transaction: %s %s", pipeline.GetName(), pipeline.GetStatus())
+	}
+
+	events := children(pipeline, typeCommand)
+	if len(events) != 2 || events[0].GetName() != "set" || events[1].GetName() != "incr" || events[1].GetStatus() != cat.FAIL {
+		t.Errorf("unexpected pipeline events: %+v", events)
+	}
+}
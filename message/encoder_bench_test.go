@@ -0,0 +1,38 @@
+package message
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func benchmarkEncoder(b *testing.B, encoder Encoder) {
+	header := &Header{Domain: "cat", Hostname: "localhost", Ip: "127.0.0.1", MessageId: "cat-7f000001-1-1"}
+	trans := NewTransaction("URL", "/foo", nil)
+	for i := 0; i < 10; i++ {
+		trans.LogEvent("Cache", "hit", CatSuccess, "key=foo")
+	}
+	trans.SetDuration(time.Millisecond)
+	trans.Complete()
+
+	buf := new(bytes.Buffer)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		if err := encoder.EncodeHeader(buf, header); err != nil {
+			b.Fatal(err)
+		}
+		if err := encoder.EncodeMessage(buf, trans); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadableEncoder(b *testing.B) {
+	benchmarkEncoder(b, NewReadableEncoder())
+}
+
+func BenchmarkBinaryEncoder(b *testing.B) {
+	benchmarkEncoder(b, NewBinaryEncoder())
+}
@@ -124,8 +124,7 @@ func (e *BinaryEncoder) EncodeHeader(buf *bytes.Buffer, header *Header) (err err
 		return
 	}
 
-	// sessionToken.
-	if err = e.writeString(buf, ""); err != nil {
+	if err = e.writeString(buf, header.SessionToken); err != nil {
 		return
 	}
 	return
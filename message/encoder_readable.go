@@ -3,7 +3,7 @@ package message
 import (
 	"bytes"
 	"errors"
-	"fmt"
+	"strconv"
 )
 
 const (
@@ -11,6 +11,8 @@ const (
 	LF  = '\n'
 )
 
+const timeLayout = "2006-01-02 15:04:05.999"
+
 const (
 	POLICY_WITHOUT_STATUS = "POLICY_WITHOUT_STATUS"
 	POLICY_WITH_DURATION  = "POLICY_WITH_DURATION"
@@ -36,7 +38,7 @@ func (e *ReadableEncoder) writeString(buf *bytes.Buffer, s string) (err error) {
 }
 
 func (e *ReadableEncoder) writeRaw(buf *bytes.Buffer, s string) (err error) {
-	if _, err = buf.Write([]byte(s)); err != nil {
+	if _, err = buf.WriteString(s); err != nil {
 		return
 	}
 	if _, err = buf.WriteRune(TAB); err != nil {
@@ -59,12 +61,14 @@ func (e *ReadableEncoder) encodeLine(buf *bytes.Buffer, message Messager, leader
 	if _, err = buf.WriteRune(leader); err != nil {
 		return
 	}
+	// the timestamp and the duration are formatted on the stack rather than in strings.
+	var b [32]byte
 	if m, ok := message.(*Transaction); ok && leader == 'T' {
-		if err = e.writeString(buf, m.GetTime().Add(m.GetDuration()).Format("2006-01-02 15:04:05.999")); err != nil {
+		if err = e.writeRawByte(buf, m.GetTime().Add(m.GetDuration()).AppendFormat(b[:0], timeLayout)); err != nil {
 			return
 		}
 	} else {
-		if err = e.writeString(buf, message.GetTime().Format("2006-01-02 15:04:05.999")); err != nil {
+		if err = e.writeRawByte(buf, message.GetTime().AppendFormat(b[:0], timeLayout)); err != nil {
 			return
 		}
 	}
@@ -83,7 +87,7 @@ func (e *ReadableEncoder) encodeLine(buf *bytes.Buffer, message Messager, leader
 		}
 
 		if m, ok := message.(*Transaction); ok && policy == POLICY_WITH_DURATION {
-			if _, err = buf.WriteString(fmt.Sprint(m.GetDuration().Microseconds())); err != nil {
+			if _, err = buf.Write(strconv.AppendInt(b[:0], m.GetDuration().Microseconds(), 10)); err != nil {
 				return
 			}
 			if err = e.writeString(buf, "us"); err != nil {
@@ -138,8 +142,7 @@ func (e *ReadableEncoder) EncodeHeader(buf *bytes.Buffer, header *Header) (err e
 	if err = e.writeString(buf, header.RootMessageId); err != nil {
 		return
 	}
-	// sessionToken.
-	if _, err = buf.WriteString(""); err != nil {
+	if _, err = buf.WriteString(header.SessionToken); err != nil {
 		return
 	}
 	if _, err = buf.WriteRune(LF); err != nil {
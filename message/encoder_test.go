@@ -1,6 +1,8 @@
 package message
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 )
 
@@ -8,3 +10,27 @@ func TestEncoderBase_EncodeHeader(t *testing.T) {
 	_ = ReadableProtocol
 	_ = BinaryProtocol
 }
+
+func TestEncodeHeaderSessionToken(t *testing.T) {
+	header := &Header{
+		Domain:       "cat",
+		MessageId:    "cat-7f000001-1-1",
+		SessionToken: "token",
+	}
+
+	buf := new(bytes.Buffer)
+	if err := NewReadableEncoder().EncodeHeader(buf, header); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(buf.String(), "\ttoken\n") {
+		t.Errorf("session token should end the readable header, got %q", buf.String())
+	}
+
+	buf.Reset()
+	if err := NewBinaryEncoder().EncodeHeader(buf, header); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(buf.String(), "\x05token") {
+		t.Errorf("session token should end the binary header, got %q", buf.String())
+	}
+}
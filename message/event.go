@@ -1,9 +1,22 @@
 package message
 
-import "context"
+import (
+	"context"
+	"sync"
+	"time"
+)
 
 type Event struct {
 	Message
+
+	// pooled is set if the event has been taken from eventPool, which Release gives it back to.
+	pooled bool
+}
+
+var eventPool = sync.Pool{
+	New: func() interface{} {
+		return new(Event)
+	},
 }
 
 func (e *Event) Complete() {
@@ -20,3 +33,27 @@ func NewEventWithContext(ctx context.Context, mtype, name string, flush Flush) *
 		Message: NewMessageWithContext(ctx, mtype, name, flush),
 	}
 }
+
+// NewPooledEvent does the same as NewEvent, taking the event from a pool which Release gives it back to.
+// Its owner must not keep it once it has been completed, the one handling it releases it.
+func NewPooledEvent(mtype, name string, flush Flush) *Event {
+	e := eventPool.Get().(*Event)
+	e.Type, e.Name, e.Status = mtype, name, CatSuccess
+	e.timestamp = time.Now()
+	e.flush = flush
+	e.pooled = true
+	return e
+}
+
+// Release gives e back to its pool once it has been handled, if it has been taken from one.
+// Nothing may refer to e afterwards.
+func (e *Event) Release() {
+	if !e.pooled {
+		return
+	}
+	// the data buffer is kept, sparing its allocation to the next event.
+	data := e.data
+	data.Reset()
+	*e = Event{Message: Message{data: data}}
+	eventPool.Put(e)
+}
@@ -0,0 +1,28 @@
+package message
+
+import (
+	"testing"
+)
+
+func TestPooledEvent(t *testing.T) {
+	e := NewPooledEvent("Cache", "miss", nil)
+	e.SetStatus("fail")
+	e.SetData("key=foo")
+	e.Release()
+
+	if e.GetType() != "" || e.GetStatus() != "" || e.GetData().Len() != 0 || e.pooled {
+		t.Errorf("a released event should be reset: %+v", e)
+	}
+
+	e = NewPooledEvent("Cache", "hit", nil)
+	if e.GetStatus() != CatSuccess || e.GetData().Len() != 0 || e.GetTime().IsZero() {
+		t.Errorf("a pooled event should be initialized: %+v", e)
+	}
+
+	// events not taken from the pool are left alone.
+	plain := NewEvent("Cache", "hit", nil)
+	plain.Release()
+	if plain.GetType() != "Cache" {
+		t.Error("an event not taken from the pool should not be released")
+	}
+}
@@ -8,4 +8,6 @@ type Header struct {
 	MessageId       string
 	ParentMessageId string
 	RootMessageId   string
+
+	SessionToken string
 }
@@ -0,0 +1,101 @@
+package message
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+)
+
+const (
+	DefaultMaxChildren = 1000
+	DefaultMaxTreeSize = 10000
+
+	// TypeTruncated is the type of the events summarizing the children which haven't been kept.
+	TypeTruncated = "Truncated"
+)
+
+var (
+	maxChildren int32 = DefaultMaxChildren
+	maxTreeSize int32 = DefaultMaxTreeSize
+)
+
+// SetTreeLimits bounds the children kept by a transaction, and the messages kept by a tree of transactions.
+// The others are summarized by Truncated events, named by their type and name, once the transaction is completed.
+// A non-positive limit disables it.
+func SetTreeLimits(children, size int) {
+	atomic.StoreInt32(&maxChildren, int32(children))
+	atomic.StoreInt32(&maxTreeSize, int32(size))
+}
+
+// TreeLimits returns the limits set by SetTreeLimits, a non-positive limit being disabled.
+func TreeLimits() (children, size int) {
+	return int(atomic.LoadInt32(&maxChildren)), int(atomic.LoadInt32(&maxTreeSize))
+}
+
+// treeSize counts the messages kept by a tree of transactions, which it is shared by.
+type treeSize struct {
+	count int32
+}
+
+// keep tells if a child bringing size messages, itself and its descendants, may be kept by a transaction having
+// count children, and counts them in the tree if so.
+func (s *treeSize) keep(count int, size int32) bool {
+	if limit := atomic.LoadInt32(&maxChildren); limit > 0 && count >= int(limit) {
+		return false
+	}
+	if limit := atomic.LoadInt32(&maxTreeSize); limit > 0 && atomic.AddInt32(&s.count, size) > limit {
+		atomic.AddInt32(&s.count, -size)
+		return false
+	}
+	return true
+}
+
+type truncatedChildren struct {
+	mtype, name string
+
+	count, fail int
+}
+
+// truncation summarizes the children a transaction hasn't kept.
+type truncation map[string]*truncatedChildren
+
+func (p truncation) add(m Messager) {
+	key := m.GetType() + "\x00" + m.GetName()
+	children, ok := p[key]
+	if !ok {
+		children = &truncatedChildren{mtype: m.GetType(), name: m.GetName()}
+		p[key] = children
+	}
+	children.count++
+	// the status of events is final, transactions are counted by fail once completed.
+	if _, ok := m.(*Event); ok {
+		p.fail(m)
+	}
+}
+
+// fail counts m as failed, unless its status is a success.
+func (p truncation) fail(m Messager) {
+	if m.GetStatus() == CatSuccess {
+		return
+	}
+	if children, ok := p[m.GetType()+"\x00"+m.GetName()]; ok {
+		children.fail++
+	}
+}
+
+func (p truncation) events() []Messager {
+	keys := make([]string, 0, len(p))
+	for key := range p {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	events := make([]Messager, 0, len(keys))
+	for _, key := range keys {
+		children := p[key]
+		e := NewEvent(TypeTruncated, children.mtype+"/"+children.name, nil)
+		e.SetData(fmt.Sprintf("count=%d&fail=%d", children.count, children.fail))
+		events = append(events, e)
+	}
+	return events
+}
@@ -0,0 +1,133 @@
+package message
+
+import (
+	"testing"
+)
+
+func setTreeLimits(t *testing.T, children, size int) {
+	SetTreeLimits(children, size)
+	t.Cleanup(func() {
+		SetTreeLimits(DefaultMaxChildren, DefaultMaxTreeSize)
+	})
+}
+
+func TestTransactionChildrenLimit(t *testing.T) {
+	setTreeLimits(t, 3, 0)
+
+	trans := NewTransaction("Batch", "import", nil)
+	for i := 0; i < 5; i++ {
+		trans.LogEvent("Row", "insert")
+	}
+	trans.LogEvent("Row", "insert", "fail")
+	trans.AddChild(NewTransaction("SQL", "select", nil))
+	trans.Complete()
+
+	children := trans.GetChildren()
+	if len(children) != 5 {
+		t.Fatalf("expected 3 children and 2 summaries, got %d", len(children))
+	}
+	for i, expected := range []struct{ name, data string }{
+		{"Row/insert", "count=3&fail=1"},
+		{"SQL/select", "count=1&fail=0"},
+	} {
+		summary := children[3+i]
+		if summary.GetType() != TypeTruncated || summary.GetName() != expected.name || summary.GetData().String() != expected.data {
+			t.Errorf("unexpected summary: %s %s %s", summary.GetType(), summary.GetName(), summary.GetData())
+		}
+	}
+}
+
+func TestTransactionTreeSizeLimit(t *testing.T) {
+	setTreeLimits(t, 0, 4)
+
+	root := NewTransaction("Batch", "import", nil)
+	child := NewTransaction("Step", "load", nil)
+	root.AddChild(child)
+	for i := 0; i < 5; i++ {
+		child.LogEvent("Row", "insert")
+		root.LogEvent("Row", "check")
+	}
+	child.Complete()
+	root.Complete()
+
+	// the tree keeps the child transaction and 3 of the events, wherever they are.
+	var kept, summarized = 0, 0
+	var walk func(m Messager)
+	walk = func(m Messager) {
+		for _, c := range m.(*Transaction).GetChildren() {
+			if c.GetType() == TypeTruncated {
+				summarized++
+				continue
+			}
+			kept++
+			if _, ok := c.(*Transaction); ok {
+				walk(c)
+			}
+		}
+	}
+	walk(root)
+
+	if kept != 4 || summarized != 2 {
+		t.Errorf("expected 4 kept messages and 2 summaries, got %d and %d", kept, summarized)
+	}
+}
+
+func TestTruncatedTransactionFailure(t *testing.T) {
+	setTreeLimits(t, 1, 0)
+
+	trans := NewTransaction("Batch", "import", nil)
+	trans.LogEvent("Row", "insert")
+	failed := NewTransaction("SQL", "insert", nil)
+	trans.AddChild(failed)
+	succeeded := NewTransaction("SQL", "insert", nil)
+	trans.AddChild(succeeded)
+	failed.SetStatus("fail")
+	failed.Complete()
+	succeeded.Complete()
+	trans.Complete()
+
+	summary := trans.GetChildren()[1]
+	if summary.GetName() != "SQL/insert" || summary.GetData().String() != "count=2&fail=1" {
+		t.Errorf("unexpected summary: %s %s", summary.GetName(), summary.GetData())
+	}
+}
+
+func TestTransactionSubtreeSize(t *testing.T) {
+	setTreeLimits(t, 0, 4)
+
+	child := NewTransaction("Step", "load", nil)
+	grandchild := NewTransaction("Step", "parse", nil)
+	child.AddChild(grandchild)
+	child.LogEvent("Row", "insert")
+
+	root := NewTransaction("Batch", "import", nil)
+	root.AddChild(child)
+	// the child brings 3 messages, a single one is left for the whole tree.
+	grandchild.LogEvent("Row", "parse")
+	grandchild.LogEvent("Row", "parse")
+	root.LogEvent("Row", "check")
+	grandchild.Complete()
+	child.Complete()
+	root.Complete()
+
+	if c := grandchild.GetChildren(); len(c) != 2 || c[1].GetType() != TypeTruncated {
+		t.Errorf("the grandchild should count its children in the tree: %+v", c)
+	}
+	if c := root.GetChildren(); len(c) != 2 || c[1].GetType() != TypeTruncated {
+		t.Errorf("the root should count the descendants of the child: %+v", c)
+	}
+}
+
+func TestTransactionUnlimited(t *testing.T) {
+	setTreeLimits(t, -1, -1)
+
+	trans := NewTransaction("Batch", "import", nil)
+	for i := 0; i < DefaultMaxChildren+1; i++ {
+		trans.LogEvent("Row", "insert")
+	}
+	trans.Complete()
+
+	if len(trans.GetChildren()) != DefaultMaxChildren+1 {
+		t.Errorf("every child should have been kept, got %d", len(trans.GetChildren()))
+	}
+}
@@ -13,6 +13,15 @@ const (
 
 type Flush func(m Messager)
 
+// Warn reports the misuses of messages which are tolerated, such as conflicting durations.
+var Warn = func(format string, args ...interface{}) {}
+
+// Forker starts the root transaction of a tree forked from the tree of ctx, see Transaction.Fork.
+// It is set by the cat package, which knows the trees.
+var Forker = func(ctx context.Context, mtype, name string) (context.Context, Transactor) {
+	return ctx, &NullTransaction{}
+}
+
 //noinspection GoNameStartsWithPackageName
 type MessageGetter interface {
 	GetType() string
@@ -41,7 +50,8 @@ type Message struct {
 
 	timestamp time.Time
 
-	data *bytes.Buffer
+	// data is kept by value, sparing an allocation per message.
+	data bytes.Buffer
 
 	flush Flush
 }
@@ -57,7 +67,6 @@ func NewMessageWithContext(cxt context.Context, mtype, name string, flush Flush)
 		Name:      name,
 		Status:    CatSuccess,
 		timestamp: time.Now(),
-		data:      new(bytes.Buffer),
 		flush:     flush,
 	}
 }
@@ -89,7 +98,7 @@ func (m *Message) GetStatus() string {
 }
 
 func (m *Message) GetData() *bytes.Buffer {
-	return m.data
+	return &m.data
 }
 
 func (m *Message) GetTime() time.Time {
@@ -83,6 +83,10 @@ func (t *NullTransaction) LogEvent(mtype, name string, args ...string) {
 	return
 }
 
+func (t *NullTransaction) Fork(mtype, name string) (context.Context, Transactor) {
+	return context.Background(), t
+}
+
 func (m *NullTransaction) GetCtx() context.Context {
 	return nil
 }
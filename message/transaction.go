@@ -1,8 +1,10 @@
 package message
 
 import (
+	"bytes"
 	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -17,47 +19,199 @@ type Transactor interface {
 	SetDurationStart(time time.Time)
 	NewEvent(mtype, name string) Messager
 	LogEvent(mtype, name string, args ...string)
+	Fork(mtype, name string) (context.Context, Transactor)
 }
 
+// Transaction is safe for concurrent use, so that work may be fanned out under a transaction.
+// Once completed, a transaction is frozen: it is flushed with the children it has at that time,
+// and the children added or the changes made afterwards are ignored with a warning.
+// The children past the limits of SetTreeLimits are summarized rather than kept.
 type Transaction struct {
 	Message
 
-	children []Messager
+	children  []Messager
+	size      *treeSize
+	truncated truncation
 
-	isCompleted bool
+	completed uint32
 
 	mu sync.Mutex
 
+	// start is the creation time, read from the monotonic clock unlike the timestamp which SetTime may change.
+	start         time.Time
 	duration      time.Duration
+	durationSet   bool
 	durationStart time.Time
 }
 
+// Complete computes the duration, unless it has been set explicitly, and flushes the transaction, once only.
+// The duration is measured from the time given to SetDurationStart if any, or else from the creation of the transaction.
 func (t *Transaction) Complete() {
-	if t.isCompleted {
+	if !atomic.CompareAndSwapUint32(&t.completed, 0, 1) {
 		return
 	}
-	t.isCompleted = true
 
-	if t.duration == 0 {
-		t.duration = time.Now().Sub(t.Message.timestamp)
+	t.mu.Lock()
+	flush := t.Message.flush
+	if len(t.truncated) > 0 {
+		t.children = append(t.children, t.truncated.events()...)
+		t.truncated = nil
+	}
+	if !t.durationSet {
+		if !t.durationStart.IsZero() {
+			t.duration = time.Since(t.durationStart)
+		} else {
+			t.duration = time.Since(t.start)
+		}
+	}
+	t.mu.Unlock()
+
+	if flush != nil {
+		flush(t)
+	}
+}
+
+// OnComplete chains fn to the flush of t, so that fn is called once t has been completed, before it is flushed.
+// It tells if fn has been chained, which it isn't once t has been completed.
+func (t *Transaction) OnComplete(fn Flush) bool {
+	if !t.lockIfOpen() {
+		return false
 	}
+	defer t.mu.Unlock()
 
-	if t.Message.flush != nil {
-		t.Message.flush(t)
+	flush := t.Message.flush
+	t.Message.flush = func(m Messager) {
+		fn(m)
+		if flush != nil {
+			flush(m)
+		}
 	}
+	return true
+}
+
+// Fork starts the root transaction of a tree forked from the tree of t, for work done asynchronously,
+// which may outlive t. It returns the context carrying the forked transaction, see cat.Fork.
+func (t *Transaction) Fork(mtype, name string) (context.Context, Transactor) {
+	return Forker(t.GetCtx(), mtype, name)
+}
+
+func (t *Transaction) IsCompleted() bool {
+	return atomic.LoadUint32(&t.completed) == 1
+}
+
+// lockIfOpen locks t unless it has been completed.
+func (t *Transaction) lockIfOpen() bool {
+	t.mu.Lock()
+	if t.IsCompleted() {
+		t.mu.Unlock()
+		return false
+	}
+	return true
+}
+
+// lockOpen locks t unless it has been completed, in which case the change named what is ignored.
+func (t *Transaction) lockOpen(what string) bool {
+	if !t.lockIfOpen() {
+		Warn("%s of completed transaction %s/%s ignored.", what, t.Type, t.Name)
+		return false
+	}
+	return true
 }
 
 func (t *Transaction) GetDuration() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	return t.duration
 }
 
+// SetDuration sets the duration explicitly, which overrides the one given by SetDurationStart.
+// Negative durations, and the ones set once the transaction has been completed, are ignored.
 func (t *Transaction) SetDuration(duration time.Duration) {
+	if duration < 0 {
+		Warn("Negative duration %s of transaction %s/%s ignored.", duration, t.Type, t.Name)
+		return
+	}
+	if !t.lockOpen("Duration") {
+		return
+	}
+	defer t.mu.Unlock()
+
+	if !t.durationStart.IsZero() {
+		Warn("Duration of transaction %s/%s overrides its duration start.", t.Type, t.Name)
+	}
 	t.duration = duration
+	t.durationSet = true
 }
+
+// SetDurationStart sets the time the duration is measured from when completing, which is the time of the
+// transaction as well, so that it ends at the time plus the duration.
+// It is ignored once the transaction has been completed or its duration has been set explicitly.
 func (t *Transaction) SetDurationStart(time time.Time) {
+	if !t.lockOpen("Duration start") {
+		return
+	}
+	defer t.mu.Unlock()
+
+	if t.durationSet {
+		Warn("Duration start of transaction %s/%s ignored, its duration has been set.", t.Type, t.Name)
+		return
+	}
 	t.durationStart = time
+	t.timestamp = time
+}
+
+func (t *Transaction) GetStatus() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.Message.GetStatus()
 }
 
+func (t *Transaction) SetStatus(status string) {
+	if t.lockOpen("Status") {
+		defer t.mu.Unlock()
+		t.Message.SetStatus(status)
+	}
+}
+
+func (t *Transaction) GetTime() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.Message.GetTime()
+}
+
+func (t *Transaction) SetTime(time time.Time) {
+	if t.lockOpen("Time") {
+		defer t.mu.Unlock()
+		t.Message.SetTime(time)
+	}
+}
+
+// GetData returns the data of t, a copy of it if t may still change: writes through the returned buffer are
+// then lost, the data of an open transaction is changed by AddData and SetData only.
+func (t *Transaction) GetData() *bytes.Buffer {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.IsCompleted() {
+		return t.Message.GetData()
+	}
+	return bytes.NewBuffer(append([]byte(nil), t.Message.GetData().Bytes()...))
+}
+
+func (t *Transaction) AddData(k string, v ...string) {
+	if t.lockOpen("Data") {
+		defer t.mu.Unlock()
+		t.Message.AddData(k, v...)
+	}
+}
+
+func (t *Transaction) SetData(v string) {
+	if t.lockOpen("Data") {
+		defer t.mu.Unlock()
+		t.Message.SetData(v)
+	}
+}
+
+// NewEvent returns an event which is a child of t, unless t has been completed.
 func (t *Transaction) NewEvent(mtype, name string) Messager {
 	var e = NewEvent(mtype, name, nil)
 	t.AddChild(e)
@@ -65,7 +219,7 @@ func (t *Transaction) NewEvent(mtype, name string) Messager {
 }
 
 func (t *Transaction) LogEvent(mtype, name string, args ...string) {
-	var e = t.NewEvent(mtype, name)
+	var e = NewEvent(mtype, name, nil)
 	if len(args) > 0 {
 		e.SetStatus(args[0])
 	}
@@ -73,16 +227,86 @@ func (t *Transaction) LogEvent(mtype, name string, args ...string) {
 		e.SetData(args[1])
 	}
 	e.Complete()
+	// the event is added once complete, so that it doesn't change while t is encoded.
+	t.AddChild(e)
 }
 
+// AddChild adds m to the children of t, unless t has been completed.
 func (t *Transaction) AddChild(m Messager) {
-	t.mu.Lock()
+	if !t.TryAddChild(m) {
+		Warn("Child %s/%s of completed transaction %s/%s ignored.", m.GetType(), m.GetName(), t.Type, t.Name)
+	}
+}
+
+// TryAddChild adds m to the children of t and tells if it has been, which it isn't once t has been completed.
+// Past the limits of SetTreeLimits, m is only counted in the summary of the children of t.
+func (t *Transaction) TryAddChild(m Messager) bool {
+	if !t.lockIfOpen() {
+		return false
+	}
 	defer t.mu.Unlock()
+
+	var size int32 = 1
+	child, isTransaction := m.(*Transaction)
+	if isTransaction {
+		// the descendants the child already has are counted in the tree as well.
+		child.mu.Lock()
+		size += atomic.LoadInt32(&child.size.count)
+		child.mu.Unlock()
+	}
+
+	if !t.size.keep(len(t.children), size) {
+		if t.truncated == nil {
+			t.truncated = make(truncation)
+		}
+		t.truncated.add(m)
+		if isTransaction && !child.OnComplete(t.truncatedCompleted) {
+			t.truncated.fail(child)
+		}
+		return true
+	}
+
+	if isTransaction {
+		child.resize(t.size)
+	}
 	t.children = append(t.children, m)
+	return true
+}
+
+// truncatedCompleted counts the failure of a child which hasn't been kept, once it has been completed,
+// unless t has been completed since.
+func (t *Transaction) truncatedCompleted(m Messager) {
+	if !t.lockIfOpen() {
+		return
+	}
+	defer t.mu.Unlock()
+
+	if t.truncated != nil {
+		t.truncated.fail(m)
+	}
 }
 
+// resize makes t and its descendant transactions count their children in size.
+func (t *Transaction) resize(size *treeSize) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.size = size
+	for _, child := range t.children {
+		if child, ok := child.(*Transaction); ok {
+			child.resize(size)
+		}
+	}
+}
+
+// GetChildren returns the children of t, a snapshot of them if t may still change.
 func (t *Transaction) GetChildren() []Messager {
-	return t.children
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.IsCompleted() {
+		return t.children
+	}
+	return append([]Messager(nil), t.children...)
 }
 
 func NewTransaction(mtype, name string, flush Flush) *Transaction {
@@ -93,8 +317,10 @@ func NewTransactionWithContext(cxt context.Context, mtype, name string, flush Fl
 	return &Transaction{
 		Message:       NewMessageWithContext(cxt, mtype, name, flush),
 		children:      make([]Messager, 0),
-		isCompleted:   false,
+		size:          &treeSize{},
+		completed:     0,
 		mu:            sync.Mutex{},
+		start:         time.Now(),
 		duration:      0,
 		durationStart: time.Time{},
 	}
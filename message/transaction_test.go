@@ -0,0 +1,189 @@
+package message
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func captureWarnings(t *testing.T) *[]string {
+	var warnings []string
+	var mu sync.Mutex
+	previous := Warn
+	Warn = func(format string, args ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+	t.Cleanup(func() {
+		Warn = previous
+	})
+	return &warnings
+}
+
+func TestTransactionDurationIgnoresSetTime(t *testing.T) {
+	trans := NewTransaction("URL", "/foo", nil)
+	trans.SetTime(time.Now().Add(-time.Hour))
+	trans.Complete()
+
+	if trans.GetDuration() >= time.Second {
+		t.Errorf("SetTime should not change the measured duration: %s", trans.GetDuration())
+	}
+}
+
+func TestTransactionDurationStart(t *testing.T) {
+	start := time.Now().Add(-5 * time.Second)
+
+	trans := NewTransaction("URL", "/foo", nil)
+	trans.SetDurationStart(start)
+	trans.Complete()
+
+	if d := trans.GetDuration(); d < 5*time.Second || d > 6*time.Second {
+		t.Errorf("the duration should be measured from the duration start: %s", d)
+	}
+	if !trans.GetTime().Equal(start) {
+		t.Errorf("the transaction should start at the duration start: %s", trans.GetTime())
+	}
+}
+
+func TestTransactionSetDurationConflicts(t *testing.T) {
+	warnings := captureWarnings(t)
+
+	trans := NewTransaction("URL", "/foo", nil)
+	trans.SetDurationStart(time.Now().Add(-5 * time.Second))
+	trans.SetDuration(time.Second)
+	trans.SetDuration(-time.Second)
+	trans.SetDurationStart(time.Now())
+	trans.Complete()
+	trans.SetDuration(time.Minute)
+
+	if trans.GetDuration() != time.Second {
+		t.Errorf("the explicit duration should win: %s", trans.GetDuration())
+	}
+	if len(*warnings) != 4 {
+		t.Errorf("expected 4 warnings, got %q", *warnings)
+	}
+}
+
+func TestReadableEncoderTransactionEnd(t *testing.T) {
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local)
+
+	trans := NewTransaction("URL", "/foo", nil)
+	trans.SetTime(start)
+	trans.SetDuration(1500 * time.Millisecond)
+	trans.AddChild(NewEvent("Event", "bar", nil))
+	trans.Complete()
+
+	buf := new(bytes.Buffer)
+	if err := NewReadableEncoder().EncodeMessage(buf, trans); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(buf.String(), "\n")
+	if !strings.HasPrefix(lines[0], "t2020-01-01 10:00:00\t") || !strings.HasPrefix(lines[2], "T2020-01-01 10:00:01.5\t") {
+		t.Errorf("the transaction should end at its time plus its duration:\n%s", buf.String())
+	}
+	if !strings.Contains(lines[2], "\t1500000us\t") {
+		t.Errorf("unexpected duration:\n%s", buf.String())
+	}
+}
+
+func TestTransactionConcurrentChildren(t *testing.T) {
+	captureWarnings(t)
+
+	encoded := make(chan string, 1)
+	root := NewTransaction("URL", "/foo", func(m Messager) {
+		buf := new(bytes.Buffer)
+		if err := NewReadableEncoder().EncodeMessage(buf, m); err != nil {
+			t.Error(err)
+		}
+		encoded <- buf.String()
+	})
+
+	var wg sync.WaitGroup
+	var start = make(chan struct{})
+	for i := 0; i < 20; i++ {
+		child := NewTransaction("Worker", strconv.Itoa(i), nil)
+		root.AddChild(child)
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			for j := 0; j < 10; j++ {
+				root.LogEvent("Event", strconv.Itoa(i))
+				child.LogEvent("Event", strconv.Itoa(j))
+				child.AddData("k", "v")
+				root.AddData("k", "v")
+			}
+			child.SetStatus("fail")
+			child.Complete()
+		}(i)
+	}
+
+	close(start)
+	root.Complete()
+	// children being added after the completion of root.
+	root.SetStatus("fail")
+	wg.Wait()
+
+	if !strings.HasPrefix(<-encoded, "t") {
+		t.Error("root should have been encoded")
+	}
+	children := root.GetChildren()
+	for _, child := range children {
+		if child.GetType() == "Worker" {
+			continue
+		}
+		if child.GetType() != "Event" {
+			t.Errorf("unexpected child: %s", child.GetType())
+		}
+	}
+	if len(root.GetChildren()) != len(children) || root.GetStatus() != CatSuccess {
+		t.Error("root should not change once completed")
+	}
+}
+
+func TestTransactionCompleteOnce(t *testing.T) {
+	var flushed int32
+	trans := NewTransaction("URL", "/foo", func(m Messager) {
+		atomic.AddInt32(&flushed, 1)
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			trans.Complete()
+		}()
+	}
+	wg.Wait()
+
+	if flushed != 1 {
+		t.Errorf("the transaction should be flushed once, got %d", flushed)
+	}
+	if trans.TryAddChild(NewEvent("Event", "late", nil)) {
+		t.Error("late children should be rejected")
+	}
+}
+
+func TestTransactionGetDataCopy(t *testing.T) {
+	trans := NewTransaction("URL", "/foo", nil)
+	trans.SetData("a=1")
+
+	trans.GetData().WriteString("&b=2")
+	if data := trans.GetData().String(); data != "a=1" {
+		t.Errorf("writes through GetData should be lost while open, got %q", data)
+	}
+
+	trans.AddData("b", "2")
+	trans.Complete()
+	if data := trans.GetData().String(); data != "a=1&b=2" {
+		t.Errorf("unexpected data: %q", data)
+	}
+}
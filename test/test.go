@@ -29,8 +29,7 @@ func case1() {
 
 	t.AddData("foo", "bar")
 
-	t.NewEvent(TestType, "event-1")
-	t.Complete()
+	t.NewEvent(TestType, "event-1").Complete()
 
 	if rand.Int31n(100) == 0 {
 		t.LogEvent(TestType, "event-2", cat.FAIL)
@@ -39,9 +38,8 @@ func case1() {
 	}
 	t.LogEvent(TestType, "event-3", cat.SUCCESS, "k=v")
 
+	// the transaction started 5 seconds ago, its duration is measured from then on.
 	t.SetDurationStart(time.Now().Add(-5 * time.Second))
-	t.SetTime(time.Now().Add(-5 * time.Second))
-	t.SetDuration(time.Millisecond * 500)
 }
 
 // send completed transaction with duration